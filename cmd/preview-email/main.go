@@ -0,0 +1,62 @@
+// Command preview-email renders an email template with sample data and prints
+// it, without sending anything or touching the database.
+//
+//	go run ./cmd/preview-email -locale en user_welcome.tmpl
+//	go run ./cmd/preview-email -list
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/y3933y3933/knowstro/internal/mailer"
+)
+
+func main() {
+	locale := flag.String("locale", mailer.DefaultLocale, "Locale to render the template in")
+	part := flag.String("part", "all", "Part of the email to print (all|subject|plain|html)")
+	list := flag.Bool("list", false, "List the available templates and exit")
+	flag.Parse()
+
+	// New fails on any template missing subject, plainBody or htmlBody, so
+	// running this also checks every template.
+	m, err := mailer.New(mailer.NopTransport{}, "Knowstro <no-reply@example.com>", mailer.DefaultLocale)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *list {
+		for _, l := range m.Locales() {
+			fmt.Printf("%s: %s\n", l, strings.Join(m.Templates(l), ", "))
+		}
+		return
+	}
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: preview-email [-locale en] [-part all|subject|plain|html] <template>")
+		os.Exit(2)
+	}
+
+	msg, err := m.Render(*locale, flag.Arg(0), mailer.SampleData())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	switch *part {
+	case "subject":
+		fmt.Println(msg.Subject)
+	case "plain":
+		fmt.Print(msg.PlainBody)
+	case "html":
+		fmt.Print(msg.HTMLBody)
+	case "all":
+		fmt.Printf("Subject: %s\n\n--- plain ---\n%s\n--- html ---\n%s", msg.Subject, msg.PlainBody, msg.HTMLBody)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown part %q\n", *part)
+		os.Exit(2)
+	}
+}
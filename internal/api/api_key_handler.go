@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y3933y3933/knowstro/internal/contexts"
+	"github.com/y3933y3933/knowstro/internal/response"
+	"github.com/y3933y3933/knowstro/internal/store"
+	"github.com/y3933y3933/knowstro/internal/utils"
+)
+
+type APIKeyHandler struct {
+	apiKeyStore store.APIKeyStore
+	logger      *slog.Logger
+}
+
+func NewAPIKeyHandler(apiKeyStore store.APIKeyStore, logger *slog.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyStore: apiKeyStore,
+		logger:      logger,
+	}
+}
+
+// CreateAPIKey issues a personal API key. The plaintext key is only returned
+// in this response.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	user := contexts.GetUser(c.Request)
+
+	var req struct {
+		Name   *string    `json:"name" binding:"required,min=1,max=100"`
+		Scopes []string   `json:"scopes" binding:"required,min=1"`
+		Expiry *time.Time `json:"expiry" binding:"omitzero"`
+	}
+
+	err := utils.ReadJSON(c, &req)
+	if err != nil {
+		h.logger.Error("decoding create api key request", "error", err)
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !store.APIKeyScopes.Include(scope) {
+			response.FailedValidationError(c, []response.FieldError{{
+				Field:   "scopes",
+				Message: fmt.Sprintf("%q is not a valid scope, expected one of %s", scope, strings.Join(store.APIKeyScopes, ", ")),
+			}})
+			return
+		}
+	}
+
+	if req.Expiry != nil && !req.Expiry.After(time.Now()) {
+		response.FailedValidationError(c, []response.FieldError{{Field: "expiry", Message: "expiry must be in the future"}})
+		return
+	}
+
+	key, err := h.apiKeyStore.CreateAPIKey(&store.APIKey{
+		UserID: user.ID,
+		Name:   *req.Name,
+		Scopes: req.Scopes,
+		Expiry: req.Expiry,
+	})
+	if err != nil {
+		h.logger.Error("create api key", "error", err)
+		switch {
+		case errors.Is(err, store.ErrDuplicateAPIKey):
+			response.FailedValidationError(c, []response.FieldError{{Field: "name", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessCreated(c, key)
+}
+
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.apiKeyStore.GetAPIKeysForUser(contexts.GetUser(c.Request).ID)
+	if err != nil {
+		h.logger.Error("get api keys for user", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	response.SuccessOK(c, keys)
+}
+
+func (h *APIKeyHandler) DeleteAPIKey(c *gin.Context) {
+	id, err := utils.ReadIDParam(c)
+	if err != nil {
+		h.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	err = h.apiKeyStore.DeleteAPIKey(id, contexts.GetUser(c.Request).ID)
+	if err != nil {
+		h.logger.Error("delete api key", "error", err)
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, nil)
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y3933y3933/knowstro/internal/contexts"
+	"github.com/y3933y3933/knowstro/internal/response"
+	"github.com/y3933y3933/knowstro/internal/store"
+	"github.com/y3933y3933/knowstro/internal/utils"
+)
+
+type CommentHandler struct {
+	commentStore store.CommentStore
+	logger       *slog.Logger
+}
+
+func NewCommentHandler(commentStore store.CommentStore, logger *slog.Logger) *CommentHandler {
+	return &CommentHandler{
+		commentStore: commentStore,
+		logger:       logger,
+	}
+}
+
+func (ch *CommentHandler) ListComments(c *gin.Context) {
+	resourceID, err := utils.ReadIDParam(c)
+	if err != nil {
+		ch.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	var errs []response.FieldError
+	filters := utils.ReadFilters(c, store.CommentSortColumns, []string{"created_at"}, &errs)
+	if len(errs) > 0 {
+		response.FailedValidationError(c, errs)
+		return
+	}
+
+	comments, metadata, err := ch.commentStore.GetCommentsForResource(resourceID, filters)
+	if err != nil {
+		ch.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			response.FailedValidationError(c, []response.FieldError{{Field: "cursor", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessList(c, comments, metadata)
+}
+
+func (ch *CommentHandler) CreateComment(c *gin.Context) {
+	user := contexts.GetUser(c.Request)
+
+	resourceID, err := utils.ReadIDParam(c)
+	if err != nil {
+		ch.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	var req struct {
+		Content  *string `json:"content" binding:"required,min=1,max=2000"`
+		ParentID *int    `json:"parent_id" binding:"omitzero,gte=1"`
+	}
+
+	if err := utils.ReadJSON(c, &req); err != nil {
+		ch.logger.Error(err.Error())
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	comment := &store.Comment{
+		UserID:     &user.ID,
+		Username:   user.Name,
+		ResourceID: int(resourceID),
+		ParentID:   req.ParentID,
+		Content:    *req.Content,
+	}
+
+	if req.ParentID != nil {
+		parent, err := ch.commentStore.GetCommentByID(int64(*req.ParentID))
+		if err != nil {
+			ch.logger.Error(err.Error())
+			switch {
+			case errors.Is(err, store.ErrRecordNotFound):
+				response.FailedValidationError(c, []response.FieldError{{Field: "parent_id", Message: "parent comment does not exist"}})
+			default:
+				response.InternalError(c)
+			}
+			return
+		}
+
+		if parent.ResourceID != comment.ResourceID {
+			response.FailedValidationError(c, []response.FieldError{{Field: "parent_id", Message: "parent comment belongs to another resource"}})
+			return
+		}
+
+		if parent.Depth >= store.MaxCommentDepth {
+			response.FailedValidationError(c, []response.FieldError{{Field: "parent_id", Message: fmt.Sprintf("replies cannot be nested more than %d levels deep", store.MaxCommentDepth)}})
+			return
+		}
+
+		comment.Depth = parent.Depth + 1
+	}
+
+	comment, err = ch.commentStore.CreateComment(comment)
+	if err != nil {
+		ch.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessCreated(c, comment)
+}
+
+func (ch *CommentHandler) UpdateComment(c *gin.Context) {
+	comment, ok := ch.readOwnComment(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Content *string `json:"content" binding:"required,min=1,max=2000"`
+	}
+
+	if err := utils.ReadJSON(c, &req); err != nil {
+		ch.logger.Error(err.Error())
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	comment.Content = *req.Content
+
+	_, err := ch.commentStore.UpdateComment(comment)
+	if err != nil {
+		ch.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, comment)
+}
+
+func (ch *CommentHandler) DeleteComment(c *gin.Context) {
+	comment, ok := ch.readOwnComment(c)
+	if !ok {
+		return
+	}
+
+	err := ch.commentStore.DeleteComment(int64(comment.ID))
+	if err != nil {
+		ch.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, nil)
+}
+
+// readOwnComment loads the comment named in the path and checks that the
+// current user wrote it. On failure the response has already been written.
+func (ch *CommentHandler) readOwnComment(c *gin.Context) (*store.Comment, bool) {
+	user := contexts.GetUser(c.Request)
+
+	id, err := utils.ReadIDParam(c)
+	if err != nil {
+		ch.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return nil, false
+	}
+
+	comment, err := ch.commentStore.GetCommentByID(id)
+	if err != nil {
+		ch.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return nil, false
+	}
+
+	if comment.UserID == nil || *comment.UserID != user.ID {
+		response.NotPermitted(c)
+		return nil, false
+	}
+
+	return comment, true
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y3933y3933/knowstro/internal/mailer"
+	"github.com/y3933y3933/knowstro/internal/response"
+	"github.com/y3933y3933/knowstro/internal/store"
+	"github.com/y3933y3933/knowstro/internal/utils"
+)
+
+var outboxStatuses = []string{store.OutboxStatusPending, store.OutboxStatusSending, store.OutboxStatusSent, store.OutboxStatusDead}
+
+// EmailHandler lets admins inspect the email outbox, retry dead emails and
+// preview the email templates.
+type EmailHandler struct {
+	outboxStore store.OutboxStore
+	mailer      *mailer.Mailer
+	logger      *slog.Logger
+}
+
+func NewEmailHandler(outboxStore store.OutboxStore, mailer *mailer.Mailer, logger *slog.Logger) *EmailHandler {
+	return &EmailHandler{
+		outboxStore: outboxStore,
+		mailer:      mailer,
+		logger:      logger,
+	}
+}
+
+func (h *EmailHandler) ListEmails(c *gin.Context) {
+	var errs []response.FieldError
+
+	status := c.Query("status")
+	if status != "" && !slices.Contains(outboxStatuses, status) {
+		errs = append(errs, response.FieldError{Field: "status", Message: fmt.Sprintf("must be one of %v", outboxStatuses)})
+	}
+
+	filters := utils.ReadFilters(c, store.OutboxSortColumns, []string{"-id"}, &errs)
+	if len(errs) > 0 {
+		response.FailedValidationError(c, errs)
+		return
+	}
+
+	emails, metadata, err := h.outboxStore.GetEmails(status, filters)
+	if err != nil {
+		h.logger.Error("get emails", "error", err)
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			response.FailedValidationError(c, []response.FieldError{{Field: "cursor", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessList(c, emails, metadata)
+}
+
+func (h *EmailHandler) GetEmail(c *gin.Context) {
+	id, err := utils.ReadIDParam(c)
+	if err != nil {
+		h.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	email, err := h.outboxStore.GetEmail(id)
+	if err != nil {
+		h.logger.Error("get email", "error", err)
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, email)
+}
+
+// RequeueEmail gives a dead email a fresh set of attempts. Emails that are not
+// dead, or whose data has been purged, are reported as not found.
+func (h *EmailHandler) RequeueEmail(c *gin.Context) {
+	id, err := utils.ReadIDParam(c)
+	if err != nil {
+		h.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	email, err := h.outboxStore.Requeue(id)
+	if err != nil {
+		h.logger.Error("requeue email", "error", err)
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, email)
+}
+
+type templateLocale struct {
+	Locale    string   `json:"locale"`
+	Templates []string `json:"templates"`
+}
+
+func (h *EmailHandler) ListTemplates(c *gin.Context) {
+	locales := []templateLocale{}
+	for _, locale := range h.mailer.Locales() {
+		locales = append(locales, templateLocale{Locale: locale, Templates: h.mailer.Templates(locale)})
+	}
+
+	response.SuccessOK(c, locales)
+}
+
+// PreviewTemplate renders a template with sample data without sending it.
+// Without a locale query parameter the default locale is used.
+func (h *EmailHandler) PreviewTemplate(c *gin.Context) {
+	locale := c.Query("locale")
+	if locale != "" && !slices.ContainsFunc(h.mailer.Locales(), func(l string) bool { return strings.EqualFold(l, locale) }) {
+		response.FailedValidationError(c, []response.FieldError{{Field: "locale", Message: fmt.Sprintf("must be one of %v", h.mailer.Locales())}})
+		return
+	}
+
+	msg, err := h.mailer.Render(locale, c.Param("name"), mailer.SampleData())
+	if err != nil {
+		h.logger.Error("render template", "error", err)
+		switch {
+		case errors.Is(err, mailer.ErrTemplateNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, msg)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y3933y3933/knowstro/internal/contexts"
+	"github.com/y3933y3933/knowstro/internal/response"
+	"github.com/y3933y3933/knowstro/internal/store"
+	"github.com/y3933y3933/knowstro/internal/utils"
+)
+
+type FavoriteHandler struct {
+	favoriteStore store.FavoriteStore
+	resourceStore store.ResourceStore
+	logger        *slog.Logger
+}
+
+func NewFavoriteHandler(favoriteStore store.FavoriteStore, resourceStore store.ResourceStore, logger *slog.Logger) *FavoriteHandler {
+	return &FavoriteHandler{
+		favoriteStore: favoriteStore,
+		resourceStore: resourceStore,
+		logger:        logger,
+	}
+}
+
+func (fh *FavoriteHandler) AddFavorite(c *gin.Context) {
+	user := contexts.GetUser(c.Request)
+
+	id, err := utils.ReadIDParam(c)
+	if err != nil {
+		fh.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	err = fh.favoriteStore.AddFavorite(user.ID, id)
+	if err != nil {
+		fh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	resource, err := fh.resourceStore.GetResourceByID(id, user.ID)
+	if err != nil {
+		fh.logger.Error(err.Error())
+		response.InternalError(c)
+		return
+	}
+
+	response.SuccessCreated(c, resource)
+}
+
+func (fh *FavoriteHandler) RemoveFavorite(c *gin.Context) {
+	user := contexts.GetUser(c.Request)
+
+	id, err := utils.ReadIDParam(c)
+	if err != nil {
+		fh.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	err = fh.favoriteStore.RemoveFavorite(user.ID, id)
+	if err != nil {
+		fh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, nil)
+}
+
+func (fh *FavoriteHandler) ListFavorites(c *gin.Context) {
+	user := contexts.GetUser(c.Request)
+
+	var errs []response.FieldError
+	filters := utils.ReadFilters(c, store.FavoriteSortColumns, []string{"-favorited_at"}, &errs)
+	if len(errs) > 0 {
+		response.FailedValidationError(c, errs)
+		return
+	}
+
+	resources, metadata, err := fh.favoriteStore.GetFavoritesForUser(user.ID, filters)
+	if err != nil {
+		fh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			response.FailedValidationError(c, []response.FieldError{{Field: "cursor", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessList(c, resources, metadata)
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y3933y3933/knowstro/internal/contexts"
+	"github.com/y3933y3933/knowstro/internal/response"
+	"github.com/y3933y3933/knowstro/internal/store"
+	"github.com/y3933y3933/knowstro/internal/throttle"
+	"github.com/y3933y3933/knowstro/internal/tokens"
+	"github.com/y3933y3933/knowstro/internal/totp"
+	"github.com/y3933y3933/knowstro/internal/utils"
+)
+
+const (
+	totpIssuer        = "Knowstro"
+	recoveryCodeCount = 10
+)
+
+type MFAHandler struct {
+	mfaStore      store.MFAStore
+	tokenStore    store.TokenStore
+	loginThrottle *throttle.LoginThrottle
+	logger        *slog.Logger
+}
+
+func NewMFAHandler(mfaStore store.MFAStore, tokenStore store.TokenStore, loginThrottle *throttle.LoginThrottle, logger *slog.Logger) *MFAHandler {
+	return &MFAHandler{
+		mfaStore:      mfaStore,
+		tokenStore:    tokenStore,
+		loginThrottle: loginThrottle,
+		logger:        logger,
+	}
+}
+
+// HandleEnrollTOTP generates a new authenticator secret for the current user.
+// It only takes effect once a code from it is confirmed.
+func (h *MFAHandler) HandleEnrollTOTP(c *gin.Context) {
+	user := contexts.GetUser(c.Request)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		h.logger.Error("generating totp secret", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	err = h.mfaStore.SetTOTPSecret(user.ID, secret)
+	if err != nil {
+		h.logger.Error("setting totp secret", "error", err)
+		switch {
+		case errors.Is(err, store.ErrMFAAlreadyEnabled):
+			response.FailedValidationError(c, []response.FieldError{{Field: "totp", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessCreated(c, gin.H{
+		"secret":      totp.EncodeSecret(secret),
+		"otpauth_uri": totp.URI(totpIssuer, user.Email, secret),
+	})
+}
+
+// HandleConfirmTOTP enables the second factor once the user proves their
+// authenticator produces valid codes, and hands out the recovery codes. Every
+// session is signed out so none predates the second factor. Wrong codes count
+// as failed logins.
+func (h *MFAHandler) HandleConfirmTOTP(c *gin.Context) {
+	user := contexts.GetUser(c.Request)
+
+	var req struct {
+		Code string `json:"code" binding:"required,len=6,numeric"`
+	}
+
+	err := utils.ReadJSON(c, &req)
+	if err != nil {
+		h.logger.Error("decoding confirm totp request", "error", err)
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	enrollment, err := h.mfaStore.GetTOTP(user.ID)
+	if err != nil {
+		h.logger.Error("getting totp", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	if enrollment.Enabled {
+		response.FailedValidationError(c, []response.FieldError{{Field: "totp", Message: store.ErrMFAAlreadyEnabled.Error()}})
+		return
+	}
+
+	if enrollment.Secret == nil {
+		response.FailedValidationError(c, []response.FieldError{{Field: "totp", Message: "no authenticator enrollment in progress"}})
+		return
+	}
+
+	valid := h.checkCode(c, user, func() (bool, error) {
+		_, ok := totp.Validate(enrollment.Secret, req.Code, time.Now())
+		return ok, nil
+	})
+	if !valid {
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		h.logger.Error("generating recovery codes", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	hashes := make([][]byte, len(codes))
+	for i, code := range codes {
+		hashes[i] = tokens.HashTokenPlainText(code)
+	}
+
+	err = h.mfaStore.EnableTOTP(user.ID, hashes)
+	if err != nil {
+		h.logger.Error("enabling totp", "error", err)
+		switch {
+		case errors.Is(err, store.ErrMFAAlreadyEnabled):
+			response.FailedValidationError(c, []response.FieldError{{Field: "totp", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	err = h.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeAuth)
+	if err != nil {
+		h.logger.Error("deleting all tokens for user", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	response.SuccessOK(c, gin.H{"recovery_codes": codes})
+}
+
+// HandleDisableTOTP turns the second factor off. It takes a current TOTP code
+// or a recovery code, so a stolen session alone is not enough. Wrong codes
+// count as failed logins.
+func (h *MFAHandler) HandleDisableTOTP(c *gin.Context) {
+	user := contexts.GetUser(c.Request)
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	err := utils.ReadJSON(c, &req)
+	if err != nil {
+		h.logger.Error("decoding disable totp request", "error", err)
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	if !user.MFAEnabled {
+		response.FailedValidationError(c, []response.FieldError{{Field: "totp", Message: store.ErrMFANotEnabled.Error()}})
+		return
+	}
+
+	valid := h.checkCode(c, user, func() (bool, error) {
+		return verifySecondFactor(h.mfaStore, user.ID, req.Code)
+	})
+	if !valid {
+		return
+	}
+
+	err = h.mfaStore.DisableTOTP(user.ID)
+	if err != nil {
+		h.logger.Error("disabling totp", "error", err)
+		switch {
+		case errors.Is(err, store.ErrMFANotEnabled):
+			response.FailedValidationError(c, []response.FieldError{{Field: "totp", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, gin.H{"message": "two-factor authentication was disabled"})
+}
+
+// checkCode runs verify on a code the user entered behind the login throttle,
+// so codes cannot be guessed faster here than at login. On failure the
+// response has already been written.
+func (h *MFAHandler) checkCode(c *gin.Context, user *store.User, verify func() (bool, error)) bool {
+	ip := c.ClientIP()
+
+	retryAfter, err := h.loginThrottle.Check(user.Name, ip, time.Now())
+	if err != nil {
+		h.logger.Error("checking login throttle", "error", err)
+		response.InternalError(c)
+		return false
+	}
+
+	if retryAfter > 0 {
+		response.TooManyLoginAttempts(c, retryAfter)
+		return false
+	}
+
+	ok, err := verify()
+	if err != nil {
+		h.logger.Error("verifying code", "error", err)
+		response.InternalError(c)
+		return false
+	}
+
+	if !ok {
+		_, _, err := h.loginThrottle.Fail(user.Name, ip, time.Now())
+		if err != nil {
+			h.logger.Error("recording failed login", "error", err)
+		}
+		response.FailedValidationError(c, []response.FieldError{{Field: "code", Message: "invalid code"}})
+		return false
+	}
+
+	return true
+}
+
+// verifySecondFactor accepts either the current TOTP code of the user or one
+// of their unused recovery codes. Both can only be used once.
+func verifySecondFactor(mfaStore store.MFAStore, userID int, code string) (bool, error) {
+	enrollment, err := mfaStore.GetTOTP(userID)
+	if err != nil {
+		return false, err
+	}
+
+	if !enrollment.Enabled {
+		return false, nil
+	}
+
+	if step, ok := totp.Validate(enrollment.Secret, code, time.Now()); ok {
+		return mfaStore.UseTOTPStep(userID, step)
+	}
+
+	return mfaStore.UseRecoveryCode(userID, tokens.HashTokenPlainText(totp.NormalizeRecoveryCode(code)))
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y3933y3933/knowstro/internal/contexts"
+	"github.com/y3933y3933/knowstro/internal/store"
+	"github.com/y3933y3933/knowstro/internal/throttle"
+	"github.com/y3933y3933/knowstro/internal/tokens"
+	"github.com/y3933y3933/knowstro/internal/totp"
+)
+
+type fakeMFAStore struct {
+	store.MFAStore
+	enrollment   store.TOTP
+	recoveryHash []byte
+	disabled     bool
+}
+
+func (f *fakeMFAStore) GetTOTP(userID int) (*store.TOTP, error) {
+	enrollment := f.enrollment
+	return &enrollment, nil
+}
+
+func (f *fakeMFAStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeMFAStore) UseRecoveryCode(userID int, hash []byte) (bool, error) {
+	return bytes.Equal(hash, f.recoveryHash), nil
+}
+
+func (f *fakeMFAStore) DisableTOTP(userID int) error {
+	f.disabled = true
+	return nil
+}
+
+// wrongCode returns a six-digit code that the secret does not produce now.
+func wrongCode(t *testing.T, secret []byte) string {
+	for _, code := range []string{"000000", "111111", "222222"} {
+		if _, ok := totp.Validate(secret, code, time.Now()); !ok {
+			return code
+		}
+	}
+	t.Fatal("every candidate code is valid")
+	return ""
+}
+
+func serveMFA(h *MFAHandler, handler gin.HandlerFunc, user *store.User, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/users/me/mfa/totp", strings.NewReader(body))
+	c.Request.RemoteAddr = "203.0.113.7:4711"
+	c.Request = contexts.SetUser(c.Request, user)
+
+	handler(c)
+	return rec
+}
+
+func TestMFACodesAreThrottled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	userPolicy := throttle.Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Minute, Window: time.Hour}
+	newHandler := func(mfaStore *fakeMFAStore) *MFAHandler {
+		loginThrottle := throttle.NewLoginThrottle(store.NewMemoryLoginAttemptStore(), userPolicy, throttle.DefaultIPPolicy, throttle.DefaultWarnAfter)
+		return NewMFAHandler(mfaStore, nil, loginThrottle, slog.New(slog.DiscardHandler))
+	}
+
+	t.Run("confirm", func(t *testing.T) {
+		h := newHandler(&fakeMFAStore{enrollment: store.TOTP{Secret: secret}})
+		user := &store.User{ID: 7, Name: "alice"}
+		body := `{"code":"` + wrongCode(t, secret) + `"}`
+
+		for range userPolicy.FreeAttempts + 1 {
+			rec := serveMFA(h, h.HandleConfirmTOTP, user, body)
+			assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		}
+
+		rec := serveMFA(h, h.HandleConfirmTOTP, user, body)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		recoveryCode := "abcde-fghij"
+		mfaStore := &fakeMFAStore{
+			enrollment:   store.TOTP{Secret: secret, Enabled: true},
+			recoveryHash: tokens.HashTokenPlainText(totp.NormalizeRecoveryCode(recoveryCode)),
+		}
+		h := newHandler(mfaStore)
+		user := &store.User{ID: 7, Name: "alice", MFAEnabled: true}
+
+		rec := serveMFA(h, h.HandleDisableTOTP, user, `{"code":"`+wrongCode(t, secret)+`"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.False(t, mfaStore.disabled)
+
+		rec = serveMFA(h, h.HandleDisableTOTP, user, `{"code":"`+recoveryCode+`"}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, mfaStore.disabled)
+	})
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y3933y3933/knowstro/internal/response"
+	"github.com/y3933y3933/knowstro/internal/store"
+	"github.com/y3933y3933/knowstro/internal/utils"
+)
+
+// NameHandler serves the endpoints of one kind of named record. Subjects and
+// tags each get their own, differing in the store, the error reporting a
+// taken name and how long a name may be.
+type NameHandler struct {
+	nameStore    store.NameStore
+	errDuplicate error
+	maxLength    int
+	logger       *slog.Logger
+}
+
+func NewNameHandler(nameStore store.NameStore, errDuplicate error, maxLength int, logger *slog.Logger) *NameHandler {
+	return &NameHandler{
+		nameStore:    nameStore,
+		errDuplicate: errDuplicate,
+		maxLength:    maxLength,
+		logger:       logger,
+	}
+}
+
+func (nh *NameHandler) List(c *gin.Context) {
+	var errs []response.FieldError
+	filters := utils.ReadFilters(c, store.NameSortColumns, []string{"name"}, &errs)
+	if len(errs) > 0 {
+		response.FailedValidationError(c, errs)
+		return
+	}
+
+	records, metadata, err := nh.nameStore.GetAll(filters)
+	if err != nil {
+		nh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			response.FailedValidationError(c, []response.FieldError{{Field: "cursor", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessList(c, records, metadata)
+}
+
+func (nh *NameHandler) Create(c *gin.Context) {
+	var req struct {
+		Name *string `json:"name" binding:"required,min=1"`
+	}
+
+	if err := utils.ReadJSON(c, &req); err != nil {
+		nh.logger.Error(err.Error())
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	if !nh.validName(c, req.Name) {
+		return
+	}
+
+	record, err := nh.nameStore.Create(*req.Name)
+	if err != nil {
+		nh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, nh.errDuplicate):
+			response.UnprocessableError(c, err.Error())
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessCreated(c, record)
+}
+
+func (nh *NameHandler) Update(c *gin.Context) {
+	id, err := utils.ReadIDParam(c)
+	if err != nil {
+		nh.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	record, err := nh.nameStore.GetByID(id)
+	if err != nil {
+		nh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	var req struct {
+		Name *string `json:"name" binding:"omitzero,min=1"`
+	}
+
+	if err := utils.ReadJSON(c, &req); err != nil {
+		nh.logger.Error(err.Error())
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	if !nh.validName(c, req.Name) {
+		return
+	}
+
+	if req.Name != nil {
+		record.Name = *req.Name
+	}
+
+	_, err = nh.nameStore.Update(record)
+	if err != nil {
+		nh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		case errors.Is(err, nh.errDuplicate):
+			response.UnprocessableError(c, err.Error())
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, record)
+}
+
+func (nh *NameHandler) GetByID(c *gin.Context) {
+	id, err := utils.ReadIDParam(c)
+	if err != nil {
+		nh.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	record, err := nh.nameStore.GetByID(id)
+	if err != nil {
+		nh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, record)
+}
+
+func (nh *NameHandler) Delete(c *gin.Context) {
+	id, err := utils.ReadIDParam(c)
+	if err != nil {
+		nh.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	err = nh.nameStore.Delete(id)
+	if err != nil {
+		nh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, nil)
+}
+
+// validName reports whether name fits the handler's maxLength, answering with
+// the same error a max binding would otherwise.
+func (nh *NameHandler) validName(c *gin.Context, name *string) bool {
+	if name == nil || utf8.RuneCountInString(*name) <= nh.maxLength {
+		return true
+	}
+
+	response.FailedValidationError(c, []response.FieldError{{
+		Field:   "Name",
+		Message: fmt.Sprintf("Name cannot be longer than %d characters", nh.maxLength),
+	}})
+	return false
+}
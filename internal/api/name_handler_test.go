@@ -0,0 +1,56 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/y3933y3933/knowstro/internal/store"
+)
+
+type fakeNameStore struct {
+	store.NameStore
+	created []string
+}
+
+func (f *fakeNameStore) Create(name string) (*store.NamedRecord, error) {
+	f.created = append(f.created, name)
+	return &store.NamedRecord{ID: len(f.created), Name: name}, nil
+}
+
+func TestNameHandlerCreateEnforcesMaxLength(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		recordName string
+		wantStatus int
+	}{
+		{name: "name at the limit", recordName: strings.Repeat("標", 50), wantStatus: http.StatusCreated},
+		{name: "name over the limit", recordName: strings.Repeat("a", 51), wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nameStore := &fakeNameStore{}
+			h := NewNameHandler(nameStore, store.ErrDuplicateTag, 50, slog.New(slog.DiscardHandler))
+
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/tags", strings.NewReader(`{"name":"`+tt.recordName+`"}`))
+
+			h.Create(c)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusCreated {
+				assert.Equal(t, []string{tt.recordName}, nameStore.created)
+			} else {
+				assert.Empty(t, nameStore.created)
+			}
+		})
+	}
+}
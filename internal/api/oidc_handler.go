@@ -0,0 +1,301 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y3933y3933/knowstro/internal/oidc"
+	"github.com/y3933y3933/knowstro/internal/response"
+	"github.com/y3933y3933/knowstro/internal/store"
+	"github.com/y3933y3933/knowstro/internal/tokens"
+)
+
+const (
+	oidcLoginTTL = 10 * time.Minute
+	// oidcNameRetries is how many suffixed names createUser tries after the
+	// one taken from the identity is already in use.
+	oidcNameRetries = 3
+)
+
+type OIDCHandler struct {
+	providers     map[string]oidc.Provider
+	identityStore store.IdentityStore
+	userStore     store.UserStore
+	tokenStore    store.TokenStore
+	logger        *slog.Logger
+}
+
+func NewOIDCHandler(providers []oidc.Provider, identityStore store.IdentityStore, userStore store.UserStore, tokenStore store.TokenStore, logger *slog.Logger) *OIDCHandler {
+	byName := make(map[string]oidc.Provider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+
+	return &OIDCHandler{
+		providers:     byName,
+		identityStore: identityStore,
+		userStore:     userStore,
+		tokenStore:    tokenStore,
+		logger:        logger,
+	}
+}
+
+// HandleLogin sends the user to the identity provider, remembering the PKCE
+// verifier and nonce for the callback.
+func (h *OIDCHandler) HandleLogin(c *gin.Context) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		response.RecordNotFound(c)
+		return
+	}
+
+	var state, verifier, nonce string
+	for _, s := range []*string{&state, &verifier, &nonce} {
+		value, err := oidc.RandomString()
+		if err != nil {
+			h.logger.Error("generating oidc login state", "error", err)
+			response.InternalError(c)
+			return
+		}
+		*s = value
+	}
+
+	err := h.identityStore.CreateLoginState(state, &store.OIDCLoginState{
+		Provider:     provider.Name(),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		Expiry:       time.Now().Add(oidcLoginTTL),
+	})
+	if err != nil {
+		h.logger.Error("creating oidc login state", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce, oidc.CodeChallenge(verifier)))
+}
+
+// HandleCallback completes a login at the identity provider. The identity is
+// matched to a linked user first, then to a user with the same verified email
+// address, and otherwise a new user is created. Created and claimed users get
+// a random password, so the response sets password_reset_required to tell
+// them that changing their email or deleting the account first needs a
+// password of their own from POST /v1/tokens/password-reset.
+func (h *OIDCHandler) HandleCallback(c *gin.Context) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		response.RecordNotFound(c)
+		return
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		response.BadRequest(c, fmt.Sprintf("identity provider returned an error: %s", providerErr))
+		return
+	}
+
+	loginState, err := h.identityStore.ConsumeLoginState(c.Query("state"))
+	if err != nil {
+		h.logger.Error("consuming oidc login state", "error", err)
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.FailedValidationError(c, []response.FieldError{{Field: "state", Message: "invalid or expired login state"}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	if loginState.Provider != provider.Name() {
+		response.FailedValidationError(c, []response.FieldError{{Field: "state", Message: "invalid or expired login state"}})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	identity, err := provider.Exchange(ctx, c.Query("code"), loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		h.logger.Error("exchanging oidc code", "provider", provider.Name(), "error", err)
+		switch {
+		case errors.Is(err, oidc.ErrExchangeFailed), errors.Is(err, oidc.ErrInvalidIDToken):
+			response.InvalidCredential(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	user, passwordReplaced, err := h.resolveUser(provider.Name(), identity)
+	if err != nil {
+		h.logger.Error("resolving oidc user", "provider", provider.Name(), "error", err)
+		switch {
+		case errors.Is(err, errMissingEmail):
+			response.FailedValidationError(c, []response.FieldError{{Field: "email", Message: err.Error()}})
+		case errors.Is(err, store.ErrDuplicateEmail):
+			response.FailedValidationError(c, []response.FieldError{{
+				Field:   "email",
+				Message: "an account with this email already exists, sign in with your password to link it",
+			}})
+		case errors.Is(err, store.ErrDuplicateUserName):
+			response.FailedValidationError(c, []response.FieldError{{
+				Field:   "name",
+				Message: "no free username could be derived from the identity, try again",
+			}})
+		case errors.Is(err, store.ErrEditConflict):
+			response.EditConflict(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	// The identity provider replaces the password, not the second factor.
+	if user.MFAEnabled {
+		pending, err := h.tokenStore.CreateNewToken(user.ID, 5*time.Minute, tokens.ScopeMFAPending)
+		if err != nil {
+			h.logger.Error("creating token", "error", err)
+			response.InternalError(c)
+			return
+		}
+
+		response.SuccessAccepted(c, gin.H{"mfa_required": true, "mfa_pending_token": pending})
+		return
+	}
+
+	token, err := h.tokenStore.CreateNewToken(user.ID, 24*time.Hour, tokens.ScopeAuth)
+	if err != nil {
+		h.logger.Error("creating token", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	response.SuccessCreated(c, gin.H{"authentication_token": token, "password_reset_required": passwordReplaced})
+}
+
+var errMissingEmail = errors.New("the identity provider did not share an email address")
+
+// resolveUser finds or creates the user of identity. It also reports whether
+// the user's password was just replaced with one nobody knows.
+func (h *OIDCHandler) resolveUser(providerName string, identity *oidc.Identity) (*store.User, bool, error) {
+	user, err := h.identityStore.GetUserForIdentity(providerName, identity.Subject)
+	if err == nil {
+		return user, false, nil
+	}
+	if !errors.Is(err, store.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	if identity.Email == "" {
+		return nil, false, errMissingEmail
+	}
+
+	link := &store.UserIdentity{
+		Provider: providerName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	// Only an address the provider has verified proves the caller owns the
+	// existing account.
+	if identity.EmailVerified {
+		user, err := h.userStore.GetUserByEmail(identity.Email)
+		switch {
+		case err == nil && !user.Activated:
+			user, err = h.claimUser(user, link)
+			return user, err == nil, err
+		case err == nil:
+			link.UserID = user.ID
+			err = h.identityStore.LinkIdentity(link)
+			if err != nil {
+				return nil, false, err
+			}
+			return user, false, nil
+		case !errors.Is(err, store.ErrRecordNotFound):
+			return nil, false, err
+		}
+	}
+
+	user, err = h.createUser(identity, link)
+	return user, err == nil, err
+}
+
+// claimUser links an identity to an unactivated account with its verified
+// email address. Anyone could have registered that account, so its password
+// is replaced with a random one and its sessions are revoked. The owner can
+// set a password of their own through a password reset.
+func (h *OIDCHandler) claimUser(user *store.User, link *store.UserIdentity) (*store.User, error) {
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.identityStore.ClaimUserWithIdentity(user, link)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// createUser signs up the user of a new identity. They get a random password
+// they can replace through a password reset.
+func (h *OIDCHandler) createUser(identity *oidc.Identity, link *store.UserIdentity) (*store.User, error) {
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	name := identity.Name
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+	name = truncateRunes(name, 45)
+
+	user := &store.User{
+		Email:     identity.Email,
+		Activated: identity.EmailVerified,
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Name = name
+	err = h.identityStore.CreateUserWithIdentity(user, link)
+	for retry := 0; retry < oidcNameRetries && errors.Is(err, store.ErrDuplicateUserName); retry++ {
+		suffix, randErr := rand.Int(rand.Reader, big.NewInt(10000))
+		if randErr != nil {
+			return nil, randErr
+		}
+
+		user.Name = fmt.Sprintf("%s-%04d", name, suffix)
+		err = h.identityStore.CreateUserWithIdentity(user, link)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y3933y3933/knowstro/internal/oidc"
+	"github.com/y3933y3933/knowstro/internal/store"
+)
+
+type fakeIdentityStore struct {
+	store.IdentityStore
+	linked  *store.UserIdentity
+	claimed *store.User
+	// takenNames is how many of the names tried by CreateUserWithIdentity
+	// collide with an existing user.
+	takenNames int
+	triedNames []string
+}
+
+func (f *fakeIdentityStore) GetUserForIdentity(provider, subject string) (*store.User, error) {
+	return nil, store.ErrRecordNotFound
+}
+
+func (f *fakeIdentityStore) LinkIdentity(identity *store.UserIdentity) error {
+	f.linked = identity
+	return nil
+}
+
+func (f *fakeIdentityStore) ClaimUserWithIdentity(user *store.User, identity *store.UserIdentity) error {
+	f.linked = identity
+	f.claimed = user
+	user.Activated = true
+	user.PendingEmail = nil
+	return nil
+}
+
+func (f *fakeIdentityStore) CreateUserWithIdentity(user *store.User, identity *store.UserIdentity) error {
+	f.triedNames = append(f.triedNames, user.Name)
+	if len(f.triedNames) <= f.takenNames {
+		return store.ErrDuplicateUserName
+	}
+	f.linked = identity
+	return nil
+}
+
+type fakeUserStore struct {
+	store.UserStore
+	user *store.User
+}
+
+func (f *fakeUserStore) GetUserByEmail(email string) (*store.User, error) {
+	return f.user, nil
+}
+
+func TestResolveUserClaimsUnactivatedAccount(t *testing.T) {
+	pendingEmail := "attacker@example.com"
+
+	tests := []struct {
+		name        string
+		activated   bool
+		wantClaimed bool
+	}{
+		{name: "activated account is linked as is", activated: true},
+		{name: "unactivated account is claimed", activated: false, wantClaimed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &store.User{ID: 7, Email: "alice@example.com", Activated: tt.activated, PendingEmail: &pendingEmail}
+			require.NoError(t, user.Password.Set("registered-pass"))
+
+			identityStore := &fakeIdentityStore{}
+			h := NewOIDCHandler(nil, identityStore, &fakeUserStore{user: user}, nil, slog.New(slog.DiscardHandler))
+
+			got, passwordReplaced, err := h.resolveUser("sso", &oidc.Identity{Subject: "sub-1", Email: "alice@example.com", EmailVerified: true})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantClaimed, passwordReplaced)
+			require.NotNil(t, identityStore.linked)
+			assert.Equal(t, user.ID, got.ID)
+			assert.True(t, got.Activated)
+
+			matches, err := got.Password.Matches("registered-pass")
+			require.NoError(t, err)
+
+			if tt.wantClaimed {
+				assert.Same(t, user, identityStore.claimed)
+				assert.False(t, matches, "the password chosen at registration no longer works")
+				assert.Nil(t, got.PendingEmail)
+			} else {
+				assert.Nil(t, identityStore.claimed)
+				assert.True(t, matches)
+			}
+		})
+	}
+}
+
+func TestCreateUserRetriesTakenNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		takenNames int
+		wantErr    error
+	}{
+		{name: "free name", takenNames: 0},
+		{name: "last suffix is free", takenNames: oidcNameRetries},
+		{name: "every name is taken", takenNames: oidcNameRetries + 1, wantErr: store.ErrDuplicateUserName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityStore := &fakeIdentityStore{takenNames: tt.takenNames}
+			h := NewOIDCHandler(nil, identityStore, nil, nil, slog.New(slog.DiscardHandler))
+
+			user, err := h.createUser(&oidc.Identity{Subject: "sub-1", Email: "alice@example.com"}, &store.UserIdentity{})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Len(t, identityStore.triedNames, oidcNameRetries+1)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, identityStore.triedNames, tt.takenNames+1)
+			assert.Equal(t, identityStore.triedNames[len(identityStore.triedNames)-1], user.Name)
+			assert.Equal(t, "alice", identityStore.triedNames[0])
+		})
+	}
+}
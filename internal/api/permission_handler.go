@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y3933y3933/knowstro/internal/response"
+	"github.com/y3933y3933/knowstro/internal/store"
+	"github.com/y3933y3933/knowstro/internal/utils"
+)
+
+type PermissionHandler struct {
+	permissionStore store.PermissionStore
+	logger          *slog.Logger
+}
+
+func NewPermissionHandler(permissionStore store.PermissionStore, logger *slog.Logger) *PermissionHandler {
+	return &PermissionHandler{
+		permissionStore: permissionStore,
+		logger:          logger,
+	}
+}
+
+func (ph *PermissionHandler) ListPermissions(c *gin.Context) {
+	userID, err := utils.ReadIDParam(c)
+	if err != nil {
+		ph.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	ph.respondWithPermissions(c, int(userID))
+}
+
+func (ph *PermissionHandler) GrantPermissions(c *gin.Context) {
+	userID, err := utils.ReadIDParam(c)
+	if err != nil {
+		ph.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	var req struct {
+		Permissions []string `json:"permissions" binding:"required,min=1,dive,required"`
+	}
+
+	if err := utils.ReadJSON(c, &req); err != nil {
+		ph.logger.Error(err.Error())
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	err = ph.permissionStore.AddForUser(int(userID), req.Permissions...)
+	if err != nil {
+		ph.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		case errors.Is(err, store.ErrInvalidPermission):
+			response.FailedValidationError(c, []response.FieldError{{Field: "permissions", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	ph.respondWithPermissions(c, int(userID))
+}
+
+func (ph *PermissionHandler) RevokePermission(c *gin.Context) {
+	userID, err := utils.ReadIDParam(c)
+	if err != nil {
+		ph.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	err = ph.permissionStore.RemoveForUser(int(userID), c.Param("code"))
+	if err != nil {
+		ph.logger.Error(err.Error())
+		response.InternalError(c)
+		return
+	}
+
+	ph.respondWithPermissions(c, int(userID))
+}
+
+func (ph *PermissionHandler) respondWithPermissions(c *gin.Context, userID int) {
+	permissions, err := ph.permissionStore.GetAllForUser(userID)
+	if err != nil {
+		ph.logger.Error(err.Error())
+		response.InternalError(c)
+		return
+	}
+
+	response.SuccessOK(c, permissions)
+}
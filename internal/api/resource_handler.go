@@ -0,0 +1,460 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y3933y3933/knowstro/internal/contexts"
+	"github.com/y3933y3933/knowstro/internal/response"
+	"github.com/y3933y3933/knowstro/internal/store"
+	"github.com/y3933y3933/knowstro/internal/utils"
+)
+
+type ResourceHandler struct {
+	resourceStore   store.ResourceStore
+	subjectStore    store.SubjectStore
+	tagStore        store.TagStore
+	permissionStore store.PermissionStore
+	logger          *slog.Logger
+}
+
+func NewResourceHandler(resourceStore store.ResourceStore, subjectStore store.SubjectStore, tagStore store.TagStore, permissionStore store.PermissionStore, logger *slog.Logger) *ResourceHandler {
+	return &ResourceHandler{
+		resourceStore:   resourceStore,
+		subjectStore:    subjectStore,
+		tagStore:        tagStore,
+		permissionStore: permissionStore,
+		logger:          logger,
+	}
+}
+
+func (rh *ResourceHandler) ListResources(c *gin.Context) {
+	var errs []response.FieldError
+	filters := utils.ReadFilters(c, store.ResourceSortColumns, []string{"-created_at"}, &errs)
+
+	resourceFilters := store.ResourceFilters{
+		TypeID:        utils.ReadInt(c, "type_id", 0, &errs),
+		Language:      c.Query("language"),
+		MinDifficulty: utils.ReadInt(c, "min_difficulty", 0, &errs),
+		MaxDifficulty: utils.ReadInt(c, "max_difficulty", 0, &errs),
+		MinRating:     utils.ReadFloat(c, "min_rating", 0, &errs),
+		Tag:           c.Query("tag"),
+		Subject:       c.Query("subject"),
+	}
+
+	if resourceFilters.MinDifficulty < 0 || resourceFilters.MinDifficulty > 5 {
+		errs = append(errs, response.FieldError{Field: "min_difficulty", Message: "min_difficulty must be between 1 and 5"})
+	}
+
+	if resourceFilters.MaxDifficulty < 0 || resourceFilters.MaxDifficulty > 5 {
+		errs = append(errs, response.FieldError{Field: "max_difficulty", Message: "max_difficulty must be between 1 and 5"})
+	}
+
+	if resourceFilters.MaxDifficulty != 0 && resourceFilters.MinDifficulty > resourceFilters.MaxDifficulty {
+		errs = append(errs, response.FieldError{Field: "min_difficulty", Message: "min_difficulty must not be greater than max_difficulty"})
+	}
+
+	if resourceFilters.MinRating < 0 || resourceFilters.MinRating > 5 {
+		errs = append(errs, response.FieldError{Field: "min_rating", Message: "min_rating must be between 0 and 5"})
+	}
+
+	if len(errs) > 0 {
+		response.FailedValidationError(c, errs)
+		return
+	}
+
+	resources, metadata, err := rh.resourceStore.GetAllResources(contexts.GetUser(c.Request).ID, resourceFilters, filters)
+	if err != nil {
+		rh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			response.FailedValidationError(c, []response.FieldError{{Field: "cursor", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessList(c, resources, metadata)
+}
+
+func (rh *ResourceHandler) SearchResources(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		response.FailedValidationError(c, []response.FieldError{{Field: "q", Message: "q is required"}})
+		return
+	}
+
+	if utf8.RuneCountInString(query) > 200 {
+		response.FailedValidationError(c, []response.FieldError{{Field: "q", Message: "q cannot be longer than 200 characters"}})
+		return
+	}
+
+	var errs []response.FieldError
+	filters := utils.ReadFilters(c, store.SearchSortColumns, []string{"-rank"}, &errs)
+	if len(errs) > 0 {
+		response.FailedValidationError(c, errs)
+		return
+	}
+
+	results, metadata, err := rh.resourceStore.SearchResources(query, contexts.GetUser(c.Request).ID, filters)
+	if err != nil {
+		rh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			response.FailedValidationError(c, []response.FieldError{{Field: "cursor", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessList(c, results, metadata)
+}
+
+func (rh *ResourceHandler) CreateResource(c *gin.Context) {
+	var req struct {
+		TypeID          *int     `json:"type_id" binding:"required,gte=1"`
+		Title           *string  `json:"title" binding:"required,min=1,max=255"`
+		Description     *string  `json:"description" binding:"omitzero"`
+		URL             *string  `json:"url" binding:"omitzero,url"`
+		Author          *string  `json:"author" binding:"omitzero,max=100"`
+		Publisher       *string  `json:"publisher" binding:"omitzero,max=100"`
+		Language        *string  `json:"language" binding:"required,min=1,max=50"`
+		DifficultyLevel *int     `json:"difficulty_level" binding:"required,gte=1,lte=5"`
+		Rating          *float64 `json:"rating" binding:"omitzero,gte=0,lte=5"`
+	}
+
+	if err := utils.ReadJSON(c, &req); err != nil {
+		rh.logger.Error(err.Error())
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	resource := &store.Resource{
+		TypeID:          *req.TypeID,
+		Title:           *req.Title,
+		Language:        *req.Language,
+		DifficultyLevel: *req.DifficultyLevel,
+		Rating:          req.Rating,
+		CreatedBy:       &contexts.GetUser(c.Request).ID,
+	}
+
+	if req.Description != nil {
+		resource.Description = *req.Description
+	}
+
+	if req.URL != nil {
+		resource.URL = *req.URL
+	}
+
+	if req.Author != nil {
+		resource.Author = *req.Author
+	}
+
+	if req.Publisher != nil {
+		resource.Publisher = *req.Publisher
+	}
+
+	resource, err := rh.resourceStore.CreateResource(resource)
+	if err != nil {
+		rh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrInvalidResourceType):
+			response.FailedValidationError(c, []response.FieldError{{Field: "type_id", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessCreated(c, resource)
+}
+
+func (rh *ResourceHandler) UpdateResource(c *gin.Context) {
+	resource, ok := rh.readWritableResource(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		TypeID          *int     `json:"type_id" binding:"omitzero,gte=1"`
+		Title           *string  `json:"title" binding:"omitzero,min=1,max=255"`
+		Description     *string  `json:"description" binding:"omitzero"`
+		URL             *string  `json:"url" binding:"omitzero,url"`
+		Author          *string  `json:"author" binding:"omitzero,max=100"`
+		Publisher       *string  `json:"publisher" binding:"omitzero,max=100"`
+		Language        *string  `json:"language" binding:"omitzero,min=1,max=50"`
+		DifficultyLevel *int     `json:"difficulty_level" binding:"omitzero,gte=1,lte=5"`
+		Rating          *float64 `json:"rating" binding:"omitzero,gte=0,lte=5"`
+	}
+
+	if err := utils.ReadJSON(c, &req); err != nil {
+		rh.logger.Error(err.Error())
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	if req.TypeID != nil {
+		resource.TypeID = *req.TypeID
+	}
+
+	if req.Title != nil {
+		resource.Title = *req.Title
+	}
+
+	if req.Description != nil {
+		resource.Description = *req.Description
+	}
+
+	if req.URL != nil {
+		resource.URL = *req.URL
+	}
+
+	if req.Author != nil {
+		resource.Author = *req.Author
+	}
+
+	if req.Publisher != nil {
+		resource.Publisher = *req.Publisher
+	}
+
+	if req.Language != nil {
+		resource.Language = *req.Language
+	}
+
+	if req.DifficultyLevel != nil {
+		resource.DifficultyLevel = *req.DifficultyLevel
+	}
+
+	if req.Rating != nil {
+		resource.Rating = req.Rating
+	}
+
+	_, err := rh.resourceStore.UpdateResource(resource)
+	if err != nil {
+		rh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		case errors.Is(err, store.ErrInvalidResourceType):
+			response.FailedValidationError(c, []response.FieldError{{Field: "type_id", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, resource)
+}
+
+func (rh *ResourceHandler) GetResourceByID(c *gin.Context) {
+	id, err := utils.ReadIDParam(c)
+	if err != nil {
+		rh.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	resource, err := rh.resourceStore.GetResourceByID(id, contexts.GetUser(c.Request).ID)
+	if err != nil {
+		rh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, resource)
+}
+
+func (rh *ResourceHandler) DeleteResource(c *gin.Context) {
+	resource, ok := rh.readWritableResource(c)
+	if !ok {
+		return
+	}
+
+	err := rh.resourceStore.DeleteResource(int64(resource.ID))
+	if err != nil {
+		rh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, nil)
+}
+
+func (rh *ResourceHandler) SetSubjects(c *gin.Context) {
+	var req struct {
+		SubjectIDs []int64 `json:"subject_ids" binding:"dive,gte=1"`
+	}
+
+	rh.updateAttachments(c, &req, func(resourceID int64) error {
+		return rh.subjectStore.SetResourceSubjects(resourceID, req.SubjectIDs)
+	})
+}
+
+func (rh *ResourceHandler) AddSubjects(c *gin.Context) {
+	var req struct {
+		SubjectIDs []int64 `json:"subject_ids" binding:"required,min=1,dive,gte=1"`
+	}
+
+	rh.updateAttachments(c, &req, func(resourceID int64) error {
+		return rh.subjectStore.AddResourceSubjects(resourceID, req.SubjectIDs)
+	})
+}
+
+func (rh *ResourceHandler) RemoveSubject(c *gin.Context) {
+	rh.removeAttachment(c, "subject_id", rh.subjectStore.RemoveResourceSubject)
+}
+
+func (rh *ResourceHandler) SetTags(c *gin.Context) {
+	var req struct {
+		TagIDs []int64 `json:"tag_ids" binding:"dive,gte=1"`
+	}
+
+	rh.updateAttachments(c, &req, func(resourceID int64) error {
+		return rh.tagStore.SetResourceTags(resourceID, req.TagIDs)
+	})
+}
+
+func (rh *ResourceHandler) AddTags(c *gin.Context) {
+	var req struct {
+		TagIDs []int64 `json:"tag_ids" binding:"required,min=1,dive,gte=1"`
+	}
+
+	rh.updateAttachments(c, &req, func(resourceID int64) error {
+		return rh.tagStore.AddResourceTags(resourceID, req.TagIDs)
+	})
+}
+
+func (rh *ResourceHandler) RemoveTag(c *gin.Context) {
+	rh.removeAttachment(c, "tag_id", rh.tagStore.RemoveResourceTag)
+}
+
+// updateAttachments decodes req, applies the change to the resource named in
+// the path and responds with the resource as it reads afterwards.
+func (rh *ResourceHandler) updateAttachments(c *gin.Context, req any, apply func(resourceID int64) error) {
+	resource, ok := rh.readWritableResource(c)
+	if !ok {
+		return
+	}
+
+	if err := utils.ReadJSON(c, req); err != nil {
+		rh.logger.Error(err.Error())
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	err := apply(int64(resource.ID))
+	if err != nil {
+		rh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrInvalidSubject):
+			response.FailedValidationError(c, []response.FieldError{{Field: "subject_ids", Message: err.Error()}})
+		case errors.Is(err, store.ErrInvalidTag):
+			response.FailedValidationError(c, []response.FieldError{{Field: "tag_ids", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	rh.GetResourceByID(c)
+}
+
+func (rh *ResourceHandler) removeAttachment(c *gin.Context, param string, remove func(resourceID, id int64) error) {
+	resource, ok := rh.readWritableResource(c)
+	if !ok {
+		return
+	}
+
+	attachmentID, err := utils.ReadNamedIDParam(c, param)
+	if err != nil {
+		rh.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return
+	}
+
+	err = remove(int64(resource.ID), attachmentID)
+	if err != nil {
+		rh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	rh.GetResourceByID(c)
+}
+
+// readWritableResource loads the resource named in the path and checks that
+// the current user may change it: they created it or hold resources:moderate.
+// Resources without a recorded creator need resources:moderate. On failure
+// the response has already been written.
+func (rh *ResourceHandler) readWritableResource(c *gin.Context) (*store.Resource, bool) {
+	user := contexts.GetUser(c.Request)
+
+	id, err := utils.ReadIDParam(c)
+	if err != nil {
+		rh.logger.Error(err.Error())
+		response.RecordNotFound(c)
+		return nil, false
+	}
+
+	resource, err := rh.resourceStore.GetResourceByID(id, user.ID)
+	if err != nil {
+		rh.logger.Error(err.Error())
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return nil, false
+	}
+
+	if resource.CreatedBy != nil && *resource.CreatedBy == user.ID {
+		return resource, true
+	}
+
+	permissions, err := rh.permissionStore.GetAllForUser(user.ID)
+	if err != nil {
+		rh.logger.Error(err.Error())
+		response.InternalError(c)
+		return nil, false
+	}
+
+	if !permissions.Include(store.PermissionResourcesModerate) {
+		response.NotPermitted(c)
+		return nil, false
+	}
+
+	return resource, true
+}
@@ -23,14 +23,26 @@ func NewResourceTypeHandler(resourceTypeStore store.ResourceTypeStore, logger *s
 }
 
 func (rh *ResourceTypeHandler) ListTypes(c *gin.Context) {
-	types, err := rh.resourceTypeStore.GetAllResourceType()
+	var errs []response.FieldError
+	filters := utils.ReadFilters(c, store.ResourceTypeSortColumns, []string{"id"}, &errs)
+	if len(errs) > 0 {
+		response.FailedValidationError(c, errs)
+		return
+	}
+
+	types, metadata, err := rh.resourceTypeStore.GetAllResourceType(filters)
 	if err != nil {
 		rh.logger.Error(err.Error())
-		response.InternalError(c)
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			response.FailedValidationError(c, []response.FieldError{{Field: "cursor", Message: err.Error()}})
+		default:
+			response.InternalError(c)
+		}
 		return
 	}
 
-	response.SuccessOK(c, types)
+	response.SuccessList(c, types, metadata)
 }
 
 func (rh *ResourceTypeHandler) CreateType(c *gin.Context) {
@@ -6,28 +6,41 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/y3933y3933/knowstro/internal/contexts"
 	"github.com/y3933y3933/knowstro/internal/response"
 	"github.com/y3933y3933/knowstro/internal/store"
+	"github.com/y3933y3933/knowstro/internal/throttle"
 	"github.com/y3933y3933/knowstro/internal/tokens"
 	"github.com/y3933y3933/knowstro/internal/utils"
 )
 
 type TokenHandler struct {
-	tokenStore store.TokenStore
-	userStore  store.UserStore
-	logger     *slog.Logger
+	tokenStore    store.TokenStore
+	userStore     store.UserStore
+	mfaStore      store.MFAStore
+	outboxStore   store.OutboxStore
+	loginThrottle *throttle.LoginThrottle
+	baseURL       string
+	logger        *slog.Logger
 }
 
 type createTokenRequest struct {
 	Name     string `json:"name" binding:"required,max=50"`
 	Password string `json:"password" binding:"required,max=15,min=8"`
+	// TOTPCode lets users with a second factor log in with a single request.
+	// It also accepts a recovery code.
+	TOTPCode string `json:"totp_code"`
 }
 
-func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, logger *slog.Logger) *TokenHandler {
+func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, mfaStore store.MFAStore, outboxStore store.OutboxStore, loginThrottle *throttle.LoginThrottle, baseURL string, logger *slog.Logger) *TokenHandler {
 	return &TokenHandler{
-		tokenStore: tokenStore,
-		userStore:  userStore,
-		logger:     logger,
+		tokenStore:    tokenStore,
+		userStore:     userStore,
+		mfaStore:      mfaStore,
+		outboxStore:   outboxStore,
+		loginThrottle: loginThrottle,
+		baseURL:       baseURL,
+		logger:        logger,
 	}
 }
 
@@ -36,7 +49,7 @@ func (h *TokenHandler) HandleCreateToken(c *gin.Context) {
 
 	err := utils.ReadJSON(c, &req)
 	if err != nil {
-		h.logger.Error("decoding register request: %v", err)
+		h.logger.Error("decoding create token request", "error", err)
 		if details, isValid := utils.ValidationErrors(err); !isValid {
 			response.FailedValidationError(c, details)
 		} else {
@@ -46,12 +59,27 @@ func (h *TokenHandler) HandleCreateToken(c *gin.Context) {
 		return
 	}
 
+	ip := c.ClientIP()
+
+	retryAfter, err := h.loginThrottle.Check(req.Name, ip, time.Now())
+	if err != nil {
+		h.logger.Error("checking login throttle", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	if retryAfter > 0 {
+		response.TooManyLoginAttempts(c, retryAfter)
+		return
+	}
+
 	user, err := h.userStore.GetUserByName(req.Name)
 	if err != nil {
-		h.logger.Error("GetUserByName: %v", err)
+		h.logger.Error("get user by name", "error", err)
 
 		switch {
 		case errors.Is(err, store.ErrRecordNotFound):
+			h.recordFailedLogin(req.Name, ip, nil)
 			response.InvalidCredential(c)
 		default:
 			response.InternalError(c)
@@ -62,22 +90,343 @@ func (h *TokenHandler) HandleCreateToken(c *gin.Context) {
 
 	passwordsDoMatch, err := user.Password.Matches(req.Password)
 	if err != nil {
-		h.logger.Error("PasswordHash.Matches: %v", err)
+		h.logger.Error("matching password", "error", err)
 		response.InternalError(c)
 		return
 	}
 
 	if !passwordsDoMatch {
+		h.recordFailedLogin(req.Name, ip, user)
 		response.InvalidCredential(c)
 		return
 	}
 
-	token, err := h.tokenStore.CreateNewToken(user.ID, 24*time.Hour, tokens.ScopeActivation)
+	if user.MFAEnabled {
+		if req.TOTPCode == "" {
+			pending, err := h.tokenStore.CreateNewToken(user.ID, 5*time.Minute, tokens.ScopeMFAPending)
+			if err != nil {
+				h.logger.Error("creating token", "error", err)
+				response.InternalError(c)
+				return
+			}
+
+			response.SuccessAccepted(c, gin.H{"mfa_required": true, "mfa_pending_token": pending})
+			return
+		}
+
+		if !h.verifySecondFactor(c, user, ip, req.TOTPCode) {
+			return
+		}
+	}
+
+	h.completeLogin(c, user)
+}
+
+// HandleCreateMFAToken exchanges an mfa_pending token and a second-factor
+// code for an authentication token.
+func (h *TokenHandler) HandleCreateMFAToken(c *gin.Context) {
+	var req struct {
+		TokenPlaintext string `json:"mfa_pending_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+
+	err := utils.ReadJSON(c, &req)
+	if err != nil {
+		h.logger.Error("decoding create mfa token request", "error", err)
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	user, err := h.userStore.GetForToken(tokens.ScopeMFAPending, req.TokenPlaintext)
+	if err != nil {
+		h.logger.Error("get for token", "error", err)
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.FailedValidationError(c, []response.FieldError{{
+				Field:   "mfa_pending_token",
+				Message: "invalid or expired mfa pending token",
+			}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	ip := c.ClientIP()
+
+	retryAfter, err := h.loginThrottle.Check(user.Name, ip, time.Now())
+	if err != nil {
+		h.logger.Error("checking login throttle", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	if retryAfter > 0 {
+		response.TooManyLoginAttempts(c, retryAfter)
+		return
+	}
+
+	if !h.verifySecondFactor(c, user, ip, req.Code) {
+		return
+	}
+
+	err = h.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeMFAPending)
+	if err != nil {
+		h.logger.Error("deleting mfa pending tokens", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	h.completeLogin(c, user)
+}
+
+// verifySecondFactor checks a TOTP or recovery code during login. Wrong codes
+// count as failed logins. It writes the error response itself and reports
+// whether the login may continue.
+func (h *TokenHandler) verifySecondFactor(c *gin.Context, user *store.User, ip, code string) bool {
+	ok, err := verifySecondFactor(h.mfaStore, user.ID, code)
+	if err != nil {
+		h.logger.Error("verifying second factor", "error", err)
+		response.InternalError(c)
+		return false
+	}
+
+	if !ok {
+		h.recordFailedLogin(user.Name, ip, user)
+		response.InvalidSecondFactor(c)
+		return false
+	}
+
+	return true
+}
+
+// completeLogin clears the failed logins of a fully authenticated user and
+// issues their authentication token.
+func (h *TokenHandler) completeLogin(c *gin.Context, user *store.User) {
+	err := h.loginThrottle.Succeed(user.Name)
 	if err != nil {
-		h.logger.Error("Creating Token: %v", err)
+		h.logger.Error("resetting login throttle", "error", err)
+	}
+
+	token, err := h.tokenStore.CreateNewToken(user.ID, 24*time.Hour, tokens.ScopeAuth)
+	if err != nil {
+		h.logger.Error("creating token", "error", err)
 		response.InternalError(c)
 		return
 	}
 
 	response.SuccessCreated(c, token)
 }
+
+// recordFailedLogin counts a failed login against the username and IP, and
+// warns the account owner by email once the failures pile up. Errors are only
+// logged since the caller is already rejecting the login.
+func (h *TokenHandler) recordFailedLogin(name, ip string, user *store.User) {
+	failures, warn, err := h.loginThrottle.Fail(name, ip, time.Now())
+	if err != nil {
+		h.logger.Error("recording failed login", "error", err)
+		return
+	}
+
+	if !warn || user == nil {
+		return
+	}
+
+	data := struct {
+		AppName   string
+		UserName  string
+		Failures  int
+		IPAddress string
+	}{
+		AppName:   "Knowstro",
+		UserName:  user.Name,
+		Failures:  failures,
+		IPAddress: ip,
+	}
+
+	err = enqueueEmail(h.outboxStore, user.Email, user.Locale, "login_warning.tmpl", data)
+	if err != nil {
+		h.logger.Error("enqueue email", "error", err)
+	}
+}
+
+// HandleDeleteToken logs out the session the request was made with.
+func (h *TokenHandler) HandleDeleteToken(c *gin.Context) {
+	err := h.tokenStore.DeleteToken(tokens.ScopeAuth, contexts.GetToken(c.Request))
+	if err != nil {
+		h.logger.Error("deleting token", "error", err)
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.InvalidAuthenticationToken(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, nil)
+}
+
+// HandleDeleteAllTokens revokes every authentication token of the current
+// user, ending all of their sessions including this one.
+func (h *TokenHandler) HandleDeleteAllTokens(c *gin.Context) {
+	user := contexts.GetUser(c.Request)
+
+	err := h.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeAuth)
+	if err != nil {
+		h.logger.Error("deleting all tokens for user", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	response.SuccessOK(c, nil)
+}
+
+// HandleCreatePasswordResetToken emails a single-use password reset token.
+// The response is the same whether or not the email belongs to an account,
+// so it cannot be used to discover registered addresses.
+func (h *TokenHandler) HandleCreatePasswordResetToken(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	err := utils.ReadJSON(c, &req)
+	if err != nil {
+		h.logger.Error("decoding password reset request", "error", err)
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	accepted := gin.H{"message": "an email will be sent to you containing password reset instructions"}
+
+	user, err := h.userStore.GetUserByEmail(req.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.SuccessAccepted(c, accepted)
+		default:
+			h.logger.Error("get user by email", "error", err)
+			response.InternalError(c)
+		}
+		return
+	}
+
+	if !user.Activated {
+		response.SuccessAccepted(c, accepted)
+		return
+	}
+
+	err = h.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopePasswordReset)
+	if err != nil {
+		h.logger.Error("deleting password reset tokens", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	token, err := h.tokenStore.CreateNewToken(user.ID, 45*time.Minute, tokens.ScopePasswordReset)
+	if err != nil {
+		h.logger.Error("creating token", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	data := struct {
+		AppName          string
+		UserName         string
+		PasswordResetURL string
+		Token            string
+	}{
+		AppName:          "Knowstro",
+		UserName:         user.Name,
+		PasswordResetURL: emailLink(h.baseURL, "/password-reset", token.Plaintext),
+		Token:            token.Plaintext,
+	}
+
+	err = enqueueEmail(h.outboxStore, user.Email, user.Locale, "password_reset.tmpl", data)
+	if err != nil {
+		h.logger.Error("enqueue email", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	response.SuccessAccepted(c, accepted)
+}
+
+// HandleCreateActivationToken replaces any outstanding activation tokens of
+// the account with a fresh one and emails it again.
+func (h *TokenHandler) HandleCreateActivationToken(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	err := utils.ReadJSON(c, &req)
+	if err != nil {
+		h.logger.Error("decoding activation token request", "error", err)
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	user, err := h.userStore.GetUserByEmail(req.Email)
+	if err != nil {
+		h.logger.Error("get user by email", "error", err)
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.FailedValidationError(c, []response.FieldError{{Field: "email", Message: "no matching email address found"}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	if user.Activated {
+		response.FailedValidationError(c, []response.FieldError{{Field: "email", Message: "user has already been activated"}})
+		return
+	}
+
+	err = h.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeActivation)
+	if err != nil {
+		h.logger.Error("deleting activation tokens", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	token, err := h.tokenStore.CreateNewToken(user.ID, 3*24*time.Hour, tokens.ScopeActivation)
+	if err != nil {
+		h.logger.Error("creating token", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	data := struct {
+		AppName       string
+		UserName      string
+		ActivationURL string
+		Token         string
+	}{
+		AppName:       "Knowstro",
+		UserName:      user.Name,
+		ActivationURL: emailLink(h.baseURL, "/activate", token.Plaintext),
+		Token:         token.Plaintext,
+	}
+
+	err = enqueueEmail(h.outboxStore, user.Email, user.Locale, "user_welcome.tmpl", data)
+	if err != nil {
+		h.logger.Error("enqueue email", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	response.SuccessAccepted(c, gin.H{"message": "an email will be sent to you containing activation instructions"})
+}
@@ -3,10 +3,12 @@ package api
 import (
 	"errors"
 	"log/slog"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/y3933y3933/knowstro/internal/mailer"
+	"github.com/y3933y3933/knowstro/internal/contexts"
 	"github.com/y3933y3933/knowstro/internal/response"
 	"github.com/y3933y3933/knowstro/internal/store"
 	"github.com/y3933y3933/knowstro/internal/tokens"
@@ -17,21 +19,26 @@ type registerUserRequest struct {
 	Name     string `json:"name" binding:"required,max=50"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,max=15,min=8"`
+	Locale   string `json:"locale" binding:"omitempty,bcp47_language_tag"`
 }
 
 type UserHandler struct {
-	userStore  store.UserStore
-	tokenStore store.TokenStore
-	logger     *slog.Logger
-	mailer     *mailer.Mailer
+	userStore   store.UserStore
+	tokenStore  store.TokenStore
+	exportStore store.ExportStore
+	outboxStore store.OutboxStore
+	baseURL     string
+	logger      *slog.Logger
 }
 
-func NewUserHandler(userStore store.UserStore, tokenStore store.TokenStore, logger *slog.Logger, mailer *mailer.Mailer) *UserHandler {
+func NewUserHandler(userStore store.UserStore, tokenStore store.TokenStore, exportStore store.ExportStore, outboxStore store.OutboxStore, baseURL string, logger *slog.Logger) *UserHandler {
 	return &UserHandler{
-		userStore:  userStore,
-		tokenStore: tokenStore,
-		logger:     logger,
-		mailer:     mailer,
+		userStore:   userStore,
+		tokenStore:  tokenStore,
+		exportStore: exportStore,
+		outboxStore: outboxStore,
+		baseURL:     baseURL,
+		logger:      logger,
 	}
 }
 
@@ -40,7 +47,7 @@ func (h *UserHandler) HandleRegisterUser(c *gin.Context) {
 
 	err := utils.ReadJSON(c, &req)
 	if err != nil {
-		h.logger.Error("decoding register request: %v", err)
+		h.logger.Error("decoding register request", "error", err)
 		if details, isValid := utils.ValidationErrors(err); !isValid {
 			response.FailedValidationError(c, details)
 		} else {
@@ -54,18 +61,45 @@ func (h *UserHandler) HandleRegisterUser(c *gin.Context) {
 		Name:      req.Name,
 		Email:     req.Email,
 		Activated: false,
+		Locale:    req.Locale,
 	}
 
 	err = user.Password.Set(req.Password)
 	if err != nil {
-		h.logger.Error("hashing password: ", err.Error())
+		h.logger.Error("hashing password", "error", err)
 		response.InternalError(c)
 		return
 	}
 
-	err = h.userStore.CreateUser(user)
+	token, err := tokens.GenerateToken(0, 3*24*time.Hour, tokens.ScopeActivation)
 	if err != nil {
-		h.logger.Error("register user: ", err.Error())
+		h.logger.Error("generate token", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	data := struct {
+		AppName       string
+		UserName      string
+		ActivationURL string
+		Token         string
+	}{
+		AppName:       "Knowstro",
+		UserName:      user.Name,
+		ActivationURL: emailLink(h.baseURL, "/activate", token.Plaintext),
+		Token:         token.Plaintext,
+	}
+
+	welcome, err := store.NewOutboxEmail(user.Email, user.Locale, "user_welcome.tmpl", data)
+	if err != nil {
+		h.logger.Error("new outbox email", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	err = h.userStore.RegisterUser(user, token, welcome)
+	if err != nil {
+		h.logger.Error("register user", "error", err)
 		switch {
 		case errors.Is(err, store.ErrDuplicateEmail):
 			response.FailedValidationError(c, []response.FieldError{{Field: "email", Message: "duplicate email"}})
@@ -79,40 +113,309 @@ func (h *UserHandler) HandleRegisterUser(c *gin.Context) {
 		return
 	}
 
-	token, err := h.tokenStore.CreateNewToken(user.ID, 3*24*time.Hour, tokens.ScopeActivation)
+	response.SuccessCreated(c, user)
+}
+
+func (h *UserHandler) HandlerActivateUser(c *gin.Context) {
+	var input struct {
+		TokenPlaintext string `json:"token" binding:"required"`
+	}
+
+	err := utils.ReadJSON(c, &input)
+	if err != nil {
+		details, isValid := utils.ValidationErrors(err)
+		if !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	user, err := h.userStore.GetForToken(tokens.ScopeActivation, input.TokenPlaintext)
 	if err != nil {
-		h.logger.Error("create new token: %v", err)
+		h.logger.Error("get for token", "error", err)
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.FailedValidationError(c, []response.FieldError{{
+				Field:   "token",
+				Message: "invalid or expired activation token",
+			}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	user.Activated = true
+
+	err = h.userStore.UpdateUser(user)
+	if err != nil {
+		h.logger.Error("update user", "error", err)
+		switch {
+		case errors.Is(err, store.ErrDuplicateEmail):
+			response.FailedValidationError(c, []response.FieldError{{Field: "email", Message: "duplicate email"}})
+		case errors.Is(err, store.ErrDuplicateUserName):
+			response.FailedValidationError(c, []response.FieldError{{Field: "name", Message: "duplicate username"}})
+
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	err = h.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeActivation)
+	if err != nil {
+		h.logger.Error("delete all tokens for user", "error", err)
 		response.InternalError(c)
 		return
 	}
-	go func() {
-		data := struct {
-			AppName       string
-			UserName      string
-			ActivationURL string
-			Token         string
+
+	response.SuccessOK(c, user)
+
+}
+
+func (h *UserHandler) HandleUpdateUserPassword(c *gin.Context) {
+	var req struct {
+		Password       string `json:"password" binding:"required,max=15,min=8"`
+		TokenPlaintext string `json:"token" binding:"required"`
+	}
+
+	err := utils.ReadJSON(c, &req)
+	if err != nil {
+		h.logger.Error("decoding update password request", "error", err)
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	user, err := h.userStore.GetForToken(tokens.ScopePasswordReset, req.TokenPlaintext)
+	if err != nil {
+		h.logger.Error("get for token", "error", err)
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.FailedValidationError(c, []response.FieldError{{
+				Field:   "token",
+				Message: "invalid or expired password reset token",
+			}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	err = user.Password.Set(req.Password)
+	if err != nil {
+		h.logger.Error("hashing password", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	err = h.userStore.UpdateUser(user)
+	if err != nil {
+		h.logger.Error("update user", "error", err)
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			response.EditConflict(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	for _, scope := range []string{tokens.ScopePasswordReset, tokens.ScopeAuth} {
+		err = h.tokenStore.DeleteAllTokensForUser(user.ID, scope)
+		if err != nil {
+			h.logger.Error("delete all tokens for user", "error", err)
+			response.InternalError(c)
+			return
+		}
+	}
+
+	response.SuccessOK(c, gin.H{"message": "your password was successfully reset"})
+}
+
+func (h *UserHandler) HandleGetCurrentUser(c *gin.Context) {
+	response.SuccessOK(c, contexts.GetUser(c.Request))
+}
+
+// HandleUpdateCurrentUser updates the profile of the signed-in user. Changing
+// the password or the email address requires the current password. A new
+// email address is only held as pending until it is confirmed through the
+// token mailed to it, and the old address is told about the request.
+func (h *UserHandler) HandleUpdateCurrentUser(c *gin.Context) {
+	user := contexts.GetUser(c.Request)
+
+	var req struct {
+		Name            *string `json:"name" binding:"omitzero,min=1,max=50"`
+		Email           *string `json:"email" binding:"omitzero,email"`
+		Password        *string `json:"password" binding:"omitzero,max=15,min=8"`
+		CurrentPassword *string `json:"current_password" binding:"omitzero"`
+		Locale          *string `json:"locale" binding:"omitzero,bcp47_language_tag"`
+	}
+
+	err := utils.ReadJSON(c, &req)
+	if err != nil {
+		h.logger.Error("decoding update user request", "error", err)
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	emailChanged := req.Email != nil && !strings.EqualFold(*req.Email, user.Email)
+
+	if req.Password != nil || emailChanged {
+		if req.CurrentPassword == nil {
+			response.FailedValidationError(c, []response.FieldError{{Field: "current_password", Message: "current_password is required to change the password or email"}})
+			return
+		}
+
+		passwordsDoMatch, err := user.Password.Matches(*req.CurrentPassword)
+		if err != nil {
+			h.logger.Error("matching password", "error", err)
+			response.InternalError(c)
+			return
+		}
+
+		if !passwordsDoMatch {
+			response.FailedValidationError(c, []response.FieldError{{Field: "current_password", Message: "current_password is incorrect"}})
+			return
+		}
+	}
+
+	if req.Name != nil {
+		user.Name = *req.Name
+	}
+
+	if req.Locale != nil {
+		user.Locale = *req.Locale
+	}
+
+	if req.Password != nil {
+		err = user.Password.Set(*req.Password)
+		if err != nil {
+			h.logger.Error("hashing password", "error", err)
+			response.InternalError(c)
+			return
+		}
+	}
+
+	if emailChanged {
+		existing, err := h.userStore.GetUserByEmail(*req.Email)
+		switch {
+		case err == nil && existing.ID != user.ID:
+			response.FailedValidationError(c, []response.FieldError{{Field: "email", Message: "duplicate email"}})
+			return
+		case err != nil && !errors.Is(err, store.ErrRecordNotFound):
+			h.logger.Error("get user by email", "error", err)
+			response.InternalError(c)
+			return
+		}
+
+		user.PendingEmail = req.Email
+	}
+
+	err = h.userStore.UpdateUser(user)
+	if err != nil {
+		h.logger.Error("update user", "error", err)
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			response.EditConflict(c)
+		case errors.Is(err, store.ErrDuplicateUserName):
+			response.FailedValidationError(c, []response.FieldError{{Field: "name", Message: "duplicate username"}})
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	// Like a reset, a new password signs out every other session and voids
+	// outstanding reset links.
+	if req.Password != nil {
+		err = h.tokenStore.DeleteOtherTokensForUser(user.ID, tokens.ScopeAuth, contexts.GetToken(c.Request))
+		if err != nil {
+			h.logger.Error("delete other tokens for user", "error", err)
+			response.InternalError(c)
+			return
+		}
+
+		err = h.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopePasswordReset)
+		if err != nil {
+			h.logger.Error("delete all tokens for user", "error", err)
+			response.InternalError(c)
+			return
+		}
+	}
+
+	if emailChanged {
+		err = h.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeEmailChange)
+		if err != nil {
+			h.logger.Error("delete all tokens for user", "error", err)
+			response.InternalError(c)
+			return
+		}
+
+		token, err := h.tokenStore.CreateNewToken(user.ID, 24*time.Hour, tokens.ScopeEmailChange)
+		if err != nil {
+			h.logger.Error("create new token", "error", err)
+			response.InternalError(c)
+			return
+		}
+
+		confirmData := struct {
+			AppName         string
+			UserName        string
+			ConfirmationURL string
+			Token           string
 		}{
-			AppName:       "Knowstro",
-			UserName:      user.Name,
-			ActivationURL: "test",
-			Token:         token.Plaintext,
+			AppName:         "Knowstro",
+			UserName:        user.Name,
+			ConfirmationURL: emailLink(h.baseURL, "/email-change", token.Plaintext),
+			Token:           token.Plaintext,
 		}
 
-		err = h.mailer.Send(user.Email, "user_welcome.tmpl", data)
+		err = enqueueEmail(h.outboxStore, *user.PendingEmail, user.Locale, "email_change_confirm.tmpl", confirmData)
 		if err != nil {
-			h.logger.Error(err.Error())
+			h.logger.Error("enqueue email", "error", err)
+			response.InternalError(c)
+			return
+		}
 
+		noticeData := struct {
+			AppName  string
+			UserName string
+			NewEmail string
+		}{
+			AppName:  "Knowstro",
+			UserName: user.Name,
+			NewEmail: *user.PendingEmail,
 		}
-	}()
-	response.SuccessCreated(c, user)
+
+		err = enqueueEmail(h.outboxStore, user.Email, user.Locale, "email_change_notice.tmpl", noticeData)
+		if err != nil {
+			h.logger.Error("enqueue email", "error", err)
+			response.InternalError(c)
+			return
+		}
+	}
+
+	response.SuccessOK(c, user)
 }
 
-func (h *UserHandler) HandlerActivateUser(c *gin.Context) {
+// HandleConfirmEmailChange swaps in the pending email address of the user the
+// email-change token belongs to.
+func (h *UserHandler) HandleConfirmEmailChange(c *gin.Context) {
 	var input struct {
 		TokenPlaintext string `json:"token" binding:"required"`
 	}
 
-	err := utils.ReadJSON(c, input)
+	err := utils.ReadJSON(c, &input)
 	if err != nil {
 		details, isValid := utils.ValidationErrors(err)
 		if !isValid {
@@ -123,14 +426,14 @@ func (h *UserHandler) HandlerActivateUser(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userStore.GetForToken(tokens.ScopeActivation, input.TokenPlaintext)
+	user, err := h.userStore.GetForToken(tokens.ScopeEmailChange, input.TokenPlaintext)
 	if err != nil {
-		h.logger.Error("get for token: %v", err)
+		h.logger.Error("get for token", "error", err)
 		switch {
 		case errors.Is(err, store.ErrRecordNotFound):
 			response.FailedValidationError(c, []response.FieldError{{
 				Field:   "token",
-				Message: "invalid or expired activation token",
+				Message: "invalid or expired email change token",
 			}})
 		default:
 			response.InternalError(c)
@@ -138,29 +441,116 @@ func (h *UserHandler) HandlerActivateUser(c *gin.Context) {
 		return
 	}
 
-	user.Activated = true
+	if user.PendingEmail == nil {
+		response.FailedValidationError(c, []response.FieldError{{
+			Field:   "token",
+			Message: "invalid or expired email change token",
+		}})
+		return
+	}
+
+	user.Email = *user.PendingEmail
+	user.PendingEmail = nil
 
 	err = h.userStore.UpdateUser(user)
 	if err != nil {
-		h.logger.Error("update user: %v", err)
+		h.logger.Error("update user", "error", err)
 		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			response.EditConflict(c)
 		case errors.Is(err, store.ErrDuplicateEmail):
 			response.FailedValidationError(c, []response.FieldError{{Field: "email", Message: "duplicate email"}})
-		case errors.Is(err, store.ErrDuplicateUserName):
-			response.FailedValidationError(c, []response.FieldError{{Field: "name", Message: "duplicate username"}})
-
 		default:
 			response.InternalError(c)
 		}
+		return
 	}
 
-	err = h.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeActivation)
+	err = h.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeEmailChange)
 	if err != nil {
-		h.logger.Error("delete all tokens for user: %v", err)
+		h.logger.Error("delete all tokens for user", "error", err)
 		response.InternalError(c)
 		return
 	}
 
 	response.SuccessOK(c, user)
+}
+
+// HandleDeleteCurrentUser deletes the signed-in user's account once the
+// password has been confirmed. Favorites and tokens are removed with it; the
+// user's comments and resources stay behind anonymized.
+func (h *UserHandler) HandleDeleteCurrentUser(c *gin.Context) {
+	user := contexts.GetUser(c.Request)
+
+	var req struct {
+		Password string `json:"password" binding:"required"`
+	}
+
+	err := utils.ReadJSON(c, &req)
+	if err != nil {
+		h.logger.Error("decoding delete user request", "error", err)
+		if details, isValid := utils.ValidationErrors(err); !isValid {
+			response.FailedValidationError(c, details)
+		} else {
+			response.BadRequest(c, err.Error())
+		}
+		return
+	}
+
+	passwordsDoMatch, err := user.Password.Matches(req.Password)
+	if err != nil {
+		h.logger.Error("matching password", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	if !passwordsDoMatch {
+		response.FailedValidationError(c, []response.FieldError{{Field: "password", Message: "password is incorrect"}})
+		return
+	}
+
+	err = h.userStore.DeleteUser(user.ID)
+	if err != nil {
+		h.logger.Error("delete user", "error", err)
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.RecordNotFound(c)
+		default:
+			response.InternalError(c)
+		}
+		return
+	}
+
+	response.SuccessOK(c, gin.H{"message": "your account was successfully deleted"})
+}
+
+// HandleExportCurrentUser returns an archive of the profile, favorites,
+// comments and resources of the signed-in user.
+func (h *UserHandler) HandleExportCurrentUser(c *gin.Context) {
+	export, err := h.exportStore.ExportUser(contexts.GetUser(c.Request))
+	if err != nil {
+		h.logger.Error("export user", "error", err)
+		response.InternalError(c)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="knowstro-export.json"`)
+	response.SuccessOK(c, export)
+}
+
+// enqueueEmail hands an email to the outbox, which sends it in the background
+// and retries until it gets through.
+func enqueueEmail(outboxStore store.OutboxStore, recipient, locale, templateFile string, data any) error {
+	email, err := store.NewOutboxEmail(recipient, locale, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	return outboxStore.Enqueue(email)
+}
 
+// emailLink builds the link to the page of the web app at baseURL that
+// completes an emailed action with token.
+func emailLink(baseURL, path, token string) string {
+	return strings.TrimSuffix(baseURL, "/") + path + "?token=" + url.QueryEscape(token)
 }
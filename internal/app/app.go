@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"fmt"
@@ -8,22 +9,43 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/y3933y3933/knowstro/internal/api"
 	"github.com/y3933y3933/knowstro/internal/mailer"
 	"github.com/y3933y3933/knowstro/internal/middleware"
+	"github.com/y3933y3933/knowstro/internal/oidc"
+	"github.com/y3933y3933/knowstro/internal/outbox"
 	"github.com/y3933y3933/knowstro/internal/store"
+	"github.com/y3933y3933/knowstro/internal/throttle"
 	"github.com/y3933y3933/knowstro/migrations"
 )
 
 const version = "1.0.0"
 
 type config struct {
-	Port int
-	Env  string
-	SMTP smtpConfig
+	Port            int
+	Env             string
+	BaseURL         string
+	TrustedProxies  []string
+	ShutdownTimeout time.Duration
+	Mail            mailConfig
+	SMTP            smtpConfig
+	LoginThrottle   loginThrottleConfig
+	Limiter         middleware.RateLimitConfig
+	OIDC            oidc.Config
+	Outbox          outbox.Config
+}
+
+type mailConfig struct {
+	Transport     string
+	MaildirDir    string
+	DefaultLocale string
 }
 
 type smtpConfig struct {
@@ -34,15 +56,32 @@ type smtpConfig struct {
 	Sender   string
 }
 
+type loginThrottleConfig struct {
+	Store string
+}
+
 type Application struct {
 	Config              config
 	Logger              *slog.Logger
 	DB                  *sql.DB
 	ResourceTypeHandler *api.ResourceTypeHandler
+	ResourceHandler     *api.ResourceHandler
+	SubjectHandler      *api.NameHandler
+	TagHandler          *api.NameHandler
+	FavoriteHandler     *api.FavoriteHandler
+	CommentHandler      *api.CommentHandler
+	PermissionHandler   *api.PermissionHandler
 	UserHandler         *api.UserHandler
 	TokenHandler        *api.TokenHandler
+	MFAHandler          *api.MFAHandler
+	APIKeyHandler       *api.APIKeyHandler
+	OIDCHandler         *api.OIDCHandler
+	EmailHandler        *api.EmailHandler
 	Mailer              *mailer.Mailer
+	OutboxWorker        *outbox.Worker
 	UserMiddleware      *middleware.UserMiddleware
+
+	wg sync.WaitGroup
 }
 
 func NewApplication() (*Application, error) {
@@ -59,36 +98,118 @@ func NewApplication() (*Application, error) {
 		panic(err)
 	}
 
-	mailer, err := mailer.New(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Sender)
+	transport, err := newMailTransport(cfg)
 	if err != nil {
-		logger.Error(err.Error())
-		os.Exit(1)
+		return nil, err
+	}
+	mailer, err := mailer.New(transport, cfg.SMTP.Sender, cfg.Mail.DefaultLocale)
+	if err != nil {
+		return nil, err
 	}
 
 	// store
 	resourceTypeStore := store.NewPostgresResourceTypeStore(pgDB)
+	resourceStore := store.NewPostgresResourceStore(pgDB)
+	subjectStore := store.NewPostgresSubjectStore(pgDB)
+	tagStore := store.NewPostgresTagStore(pgDB)
+	favoriteStore := store.NewPostgresFavoriteStore(pgDB)
+	commentStore := store.NewPostgresCommentStore(pgDB)
+	permissionStore := store.NewPostgresPermissionStore(pgDB)
 	userStore := store.NewPostgresUserStore(pgDB)
 	tokenStore := store.NewPostgresTokenStore(pgDB)
+	exportStore := store.NewPostgresExportStore(pgDB)
+	mfaStore := store.NewPostgresMFAStore(pgDB)
+	apiKeyStore := store.NewPostgresAPIKeyStore(pgDB)
+	identityStore := store.NewPostgresIdentityStore(pgDB)
+	outboxStore := store.NewPostgresOutboxStore(pgDB)
+
+	var providers []oidc.Provider
+	if cfg.OIDC.Issuer != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		provider, err := oidc.NewProvider(ctx, cfg.OIDC, nil)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+
+	// A single instance can keep login attempts in memory; clustered
+	// deployments share them through Postgres.
+	var loginAttemptStore store.LoginAttemptStore
+	switch cfg.LoginThrottle.Store {
+	case "memory":
+		loginAttemptStore = store.NewMemoryLoginAttemptStore()
+	case "postgres":
+		loginAttemptStore = store.NewPostgresLoginAttemptStore(pgDB)
+	default:
+		return nil, fmt.Errorf("unknown login throttle store %q", cfg.LoginThrottle.Store)
+	}
+	loginThrottle := throttle.NewLoginThrottle(loginAttemptStore, throttle.DefaultUserPolicy, throttle.DefaultIPPolicy, throttle.DefaultWarnAfter)
 
 	// handlers
 	resourceTypeHandler := api.NewResourceTypeHandler(resourceTypeStore, logger)
-	userHandler := api.NewUserHandler(userStore, tokenStore, logger, mailer)
-	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
+	resourceHandler := api.NewResourceHandler(resourceStore, subjectStore, tagStore, permissionStore, logger)
+	subjectHandler := api.NewNameHandler(subjectStore, store.ErrDuplicateSubject, 100, logger)
+	tagHandler := api.NewNameHandler(tagStore, store.ErrDuplicateTag, 50, logger)
+	favoriteHandler := api.NewFavoriteHandler(favoriteStore, resourceStore, logger)
+	commentHandler := api.NewCommentHandler(commentStore, logger)
+	permissionHandler := api.NewPermissionHandler(permissionStore, logger)
+	userHandler := api.NewUserHandler(userStore, tokenStore, exportStore, outboxStore, cfg.BaseURL, logger)
+	tokenHandler := api.NewTokenHandler(tokenStore, userStore, mfaStore, outboxStore, loginThrottle, cfg.BaseURL, logger)
+	mfaHandler := api.NewMFAHandler(mfaStore, tokenStore, loginThrottle, logger)
+	apiKeyHandler := api.NewAPIKeyHandler(apiKeyStore, logger)
+	oidcHandler := api.NewOIDCHandler(providers, identityStore, userStore, tokenStore, logger)
+	emailHandler := api.NewEmailHandler(outboxStore, mailer, logger)
 
 	app := &Application{
 		Config:              cfg,
 		Logger:              logger,
 		DB:                  pgDB,
 		ResourceTypeHandler: resourceTypeHandler,
+		ResourceHandler:     resourceHandler,
+		SubjectHandler:      subjectHandler,
+		TagHandler:          tagHandler,
+		FavoriteHandler:     favoriteHandler,
+		CommentHandler:      commentHandler,
+		PermissionHandler:   permissionHandler,
 		UserHandler:         userHandler,
 		TokenHandler:        tokenHandler,
+		MFAHandler:          mfaHandler,
+		APIKeyHandler:       apiKeyHandler,
+		OIDCHandler:         oidcHandler,
+		EmailHandler:        emailHandler,
 		Mailer:              mailer,
-		UserMiddleware:      &middleware.UserMiddleware{UserStore: userStore},
+		OutboxWorker:        outbox.NewWorker(outboxStore, mailer, cfg.Outbox, logger),
+		UserMiddleware: &middleware.UserMiddleware{
+			UserStore:         userStore,
+			PermissionStore:   permissionStore,
+			APIKeyStore:       apiKeyStore,
+			FailedAuthLimiter: middleware.NewFailedAuthLimiter(cfg.Limiter.WithLimit(0.2, 5)),
+			Logger:            logger,
+		},
 	}
 
 	return app, nil
 }
 
+// newMailTransport picks how emails leave the application. Local development
+// and CI can use maildir or nop to work without a mail server. The in-memory
+// transport is left to tests, since nothing here would ever read or clear
+// what it keeps.
+func newMailTransport(cfg config) (mailer.Transport, error) {
+	switch cfg.Mail.Transport {
+	case "smtp":
+		return mailer.NewSMTPTransport(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password)
+	case "maildir":
+		return mailer.NewMaildirTransport(cfg.Mail.MaildirDir)
+	case "nop":
+		return mailer.NopTransport{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.Mail.Transport)
+	}
+}
+
 func (a *Application) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"version":     version,
@@ -113,16 +234,64 @@ func defaultInt(key string, fallback int) int {
 	return fallback
 }
 
+func defaultFloat(key string, fallback float64) float64 {
+	if s := os.Getenv(key); s != "" {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
+
+func defaultBool(key string, fallback bool) bool {
+	if s := os.Getenv(key); s != "" {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func defaultDuration(key string, fallback time.Duration) time.Duration {
+	if s := os.Getenv(key); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
 func loadConfig() config {
-	cfg := config{}
-	fmt.Println("os Getenv", os.Getenv("SMTP_USERNAME"))
+	cfg := config{Outbox: outbox.DefaultConfig}
 	flag.IntVar(&cfg.Port, "port", defaultInt("PORT", 8080), "API server port")
 	flag.StringVar(&cfg.Env, "env", defaultString("ENV", "development"), "Environment (dev|prod)")
+	flag.StringVar(&cfg.BaseURL, "base-url", defaultString("BASE_URL", "http://localhost:3000"), "Base URL of the web app that links in emails point to")
+	trustedProxies := flag.String("trusted-proxies", defaultString("TRUSTED_PROXIES", ""), "Comma-separated IPs or CIDRs of proxies whose X-Forwarded-For is believed, empty to trust none")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", defaultDuration("SHUTDOWN_TIMEOUT", 30*time.Second), "Grace period on shutdown for in-flight requests, and then again for background tasks")
+	flag.StringVar(&cfg.Mail.Transport, "mail-transport", defaultString("MAIL_TRANSPORT", "smtp"), "Mail transport (smtp|maildir|nop)")
+	flag.StringVar(&cfg.Mail.MaildirDir, "mail-maildir", defaultString("MAIL_MAILDIR", "tmp/maildir"), "Maildir that the maildir transport writes to")
+	flag.StringVar(&cfg.Mail.DefaultLocale, "mail-default-locale", defaultString("MAIL_DEFAULT_LOCALE", mailer.DefaultLocale), "Locale of emails to users without a supported locale")
 	flag.StringVar(&cfg.SMTP.Host, "smtp-host", defaultString("SMTP_HOST", "sandbox.smtp.mailtrap.io"), "SMTP host")
 	flag.IntVar(&cfg.SMTP.Port, "smtp-port", defaultInt("SMTP_PORT", 25), "SMTP port")
 	flag.StringVar(&cfg.SMTP.Username, "smtp-username", defaultString("SMTP_USERNAME", ""), "SMTP username")
 	flag.StringVar(&cfg.SMTP.Password, "smtp-password", defaultString("SMTP_PASSWORD", ""), "SMTP password")
 	flag.StringVar(&cfg.SMTP.Sender, "smtp-sender", defaultString("SMTP_SENDER", ""), "SMTP sender")
+	flag.BoolVar(&cfg.Limiter.Enabled, "limiter-enabled", defaultBool("LIMITER_ENABLED", true), "Enable rate limiter")
+	flag.Float64Var(&cfg.Limiter.Rate, "limiter-rps", defaultFloat("LIMITER_RPS", 2), "Rate limiter maximum requests per second")
+	flag.IntVar(&cfg.Limiter.Burst, "limiter-burst", defaultInt("LIMITER_BURST", 4), "Rate limiter maximum burst")
+	flag.StringVar(&cfg.OIDC.Name, "oidc-name", defaultString("OIDC_NAME", "sso"), "OIDC provider name used in login URLs")
+	flag.StringVar(&cfg.OIDC.Issuer, "oidc-issuer", defaultString("OIDC_ISSUER", ""), "OIDC issuer URL, leave empty to disable")
+	flag.StringVar(&cfg.OIDC.ClientID, "oidc-client-id", defaultString("OIDC_CLIENT_ID", ""), "OIDC client ID")
+	flag.StringVar(&cfg.OIDC.ClientSecret, "oidc-client-secret", defaultString("OIDC_CLIENT_SECRET", ""), "OIDC client secret")
+	flag.StringVar(&cfg.OIDC.RedirectURL, "oidc-redirect-url", defaultString("OIDC_REDIRECT_URL", ""), "OIDC redirect URL, ending in /v1/oidc/<name>/callback")
+	flag.IntVar(&cfg.Outbox.Workers, "outbox-workers", defaultInt("OUTBOX_WORKERS", cfg.Outbox.Workers), "Number of email outbox workers")
+	flag.IntVar(&cfg.Outbox.MaxAttempts, "outbox-max-attempts", defaultInt("OUTBOX_MAX_ATTEMPTS", cfg.Outbox.MaxAttempts), "Send attempts before an email is dead-lettered")
+	flag.StringVar(&cfg.LoginThrottle.Store, "login-throttle-store", defaultString("LOGIN_THROTTLE_STORE", "memory"), "Login attempt store (memory|postgres)")
 	flag.Parse()
+
+	cfg.TrustedProxies = strings.FieldsFunc(*trustedProxies, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
 	return cfg
 }
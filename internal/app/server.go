@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Serve runs the API server and the background workers until SIGINT or
+// SIGTERM. In-flight requests then get the configured grace period to finish,
+// and background tasks get a grace period of their own after that, so the
+// caller can safely close the database once Serve returns.
+func (a *Application) Serve(handler http.Handler) error {
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", a.Config.Port),
+		Handler:      handler,
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	a.Background(func() {
+		a.OutboxWorker.Run(ctx)
+	})
+
+	a.Logger.Info("starting server", "addr", srv.Addr, "env", a.Config.Env)
+
+	err = a.serve(ctx, stop, srv, ln)
+	if err != nil {
+		return err
+	}
+
+	a.Logger.Info("stopped server", "addr", srv.Addr)
+	return nil
+}
+
+// serve answers requests on ln until ctx is done and then shuts down. If the
+// server fails first, stop cancels ctx so the background tasks end as well.
+func (a *Application) serve(ctx context.Context, stop context.CancelFunc, srv *http.Server, ln net.Listener) error {
+	shutdownError := make(chan error)
+
+	go func() {
+		<-ctx.Done()
+		shutdownError <- a.shutdown(srv)
+	}()
+
+	err := srv.Serve(ln)
+	if !errors.Is(err, http.ErrServerClosed) {
+		stop()
+		<-shutdownError
+		return err
+	}
+
+	return <-shutdownError
+}
+
+// shutdown stops srv and then waits for the background tasks. Each step has
+// its own grace period: requests that use up theirs must not cut the wait
+// for tasks that may still be writing to the database.
+func (a *Application) shutdown(srv *http.Server) error {
+	a.Logger.Info("shutting down server", "addr", srv.Addr, "grace_period", a.Config.ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+
+	a.Logger.Info("completing background tasks")
+
+	backgroundCtx, cancelBackground := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
+	defer cancelBackground()
+
+	waitErr := a.waitBackground(backgroundCtx)
+	if err == nil {
+		err = waitErr
+	}
+
+	return err
+}
+
+// Background runs fn in its own goroutine and makes shutdown wait for it. A
+// panic in fn is logged instead of taking the server down.
+func (a *Application) Background(fn func()) {
+	a.wg.Add(1)
+
+	go func() {
+		defer a.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				a.Logger.Error("background task panicked", "error", err)
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// waitBackground waits for every task started with Background, or until ctx
+// is done. Emails a worker did not get to stay in the outbox for next time.
+func (a *Application) waitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for background tasks: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackground(t *testing.T) {
+	a := &Application{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	var finished atomic.Int32
+	release := make(chan struct{})
+
+	for range 3 {
+		a.Background(func() {
+			<-release
+			finished.Add(1)
+		})
+	}
+	a.Background(func() {
+		panic("boom")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, a.waitBackground(ctx), context.DeadlineExceeded, "tasks are still running")
+
+	close(release)
+
+	err := a.waitBackground(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), finished.Load(), "a panicking task should not stop the others")
+}
+
+func TestServeWaitsForBackgroundAfterFailedShutdown(t *testing.T) {
+	a := &Application{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	a.Config.ShutdownTimeout = 200 * time.Millisecond
+
+	requestStarted := make(chan struct{})
+	releaseRequest := make(chan struct{})
+	defer close(releaseRequest)
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requestStarted)
+		<-releaseRequest
+	})}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	// The task outlives the request grace period but not its own.
+	var finished atomic.Bool
+	a.Background(func() {
+		<-ctx.Done()
+		time.Sleep(300 * time.Millisecond)
+		finished.Store(true)
+	})
+
+	served := make(chan error)
+	go func() {
+		served <- a.serve(ctx, stop, srv, ln)
+	}()
+
+	go http.Get("http://" + ln.Addr().String())
+	<-requestStarted
+	stop()
+
+	err = <-served
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the stuck request outlives its grace period")
+	assert.True(t, finished.Load(), "serve returns only after the background task")
+}
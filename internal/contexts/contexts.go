@@ -9,7 +9,11 @@ import (
 
 type contextKey = string
 
-const UserContextKey = contextKey("user")
+const (
+	UserContextKey   = contextKey("user")
+	TokenContextKey  = contextKey("token")
+	APIKeyContextKey = contextKey("api_key")
+)
 
 func SetUser(r *http.Request, user *store.User) *http.Request {
 	ctx := context.WithValue(r.Context(), UserContextKey, user)
@@ -24,3 +28,29 @@ func GetUser(r *http.Request) *store.User {
 
 	return user
 }
+
+// SetToken records the plaintext bearer token the request authenticated with.
+func SetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), TokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// GetToken returns the bearer token of the request, or "" for anonymous
+// requests.
+func GetToken(r *http.Request) string {
+	token, _ := r.Context().Value(TokenContextKey).(string)
+	return token
+}
+
+// SetAPIKey records the personal API key the request authenticated with.
+func SetAPIKey(r *http.Request, key *store.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), APIKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// GetAPIKey returns the API key of the request, or nil when the request was
+// made anonymously or with a session token.
+func GetAPIKey(r *http.Request) *store.APIKey {
+	key, _ := r.Context().Value(APIKeyContextKey).(*store.APIKey)
+	return key
+}
@@ -3,88 +3,205 @@ package mailer
 import (
 	"bytes"
 	"embed"
-	"time"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
 
 	ht "html/template"
 	tt "text/template"
-
-	"github.com/wneessen/go-mail"
 )
 
 //go:embed "templates"
 var templateFS embed.FS
 
-type Mailer struct {
-	client *mail.Client
-	sender string
+// DefaultLocale is the language used when neither the requested locale nor
+// any of its parents has a template.
+const DefaultLocale = "zh-Hant"
+
+// templateBlocks are the templates every email template file must define.
+var templateBlocks = []string{"subject", "plainBody", "htmlBody"}
+
+var ErrTemplateNotFound = errors.New("mailer: template not found")
+
+// emailTemplate is one template file, parsed for both the plain text and the
+// HTML parts of a message.
+type emailTemplate struct {
+	text *tt.Template
+	html *ht.Template
 }
 
-func New(host string, port int, username, password, sender string) (*Mailer, error) {
-	client, err := mail.NewClient(
-		host,
-		mail.WithSMTPAuth(mail.SMTPAuthLogin),
-		mail.WithPort(port),
-		mail.WithUsername(username),
-		mail.WithPassword(password),
-		mail.WithTimeout(5*time.Second),
-	)
+type Mailer struct {
+	transport     Transport
+	sender        string
+	defaultLocale string
+	locales       []string
+	// templates maps a lowercased locale to its template files.
+	templates map[string]map[string]*emailTemplate
+}
 
+// New parses every template under templates/<locale>/ up front, so a broken
+// or incomplete template fails at startup rather than when an email is sent.
+func New(transport Transport, sender, defaultLocale string) (*Mailer, error) {
+	templates, locales, err := parseTemplates(templateFS)
 	if err != nil {
 		return nil, err
 	}
 
+	if _, ok := templates[strings.ToLower(defaultLocale)]; !ok {
+		return nil, fmt.Errorf("mailer: no templates for default locale %q", defaultLocale)
+	}
+
 	mailer := &Mailer{
-		client: client,
-		sender: sender,
+		transport:     transport,
+		sender:        sender,
+		defaultLocale: defaultLocale,
+		locales:       locales,
+		templates:     templates,
 	}
 
 	return mailer, nil
 }
 
-func (m *Mailer) Send(recipient string, templateFile string, data any) error {
+func parseTemplates(fsys fs.FS) (map[string]map[string]*emailTemplate, []string, error) {
+	dirs, err := fs.ReadDir(fsys, "templates")
+	if err != nil {
+		return nil, nil, err
+	}
 
-	textTmpl, err := tt.New("").ParseFS(templateFS, "templates/"+templateFile)
+	templates := make(map[string]map[string]*emailTemplate)
+	var locales []string
+
+	for _, locale := range dirs {
+		if !locale.IsDir() {
+			continue
+		}
+
+		dir := path.Join("templates", locale.Name())
+		files, err := fs.Glob(fsys, path.Join(dir, "*.tmpl"))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		byFile := make(map[string]*emailTemplate, len(files))
+		for _, file := range files {
+			textTmpl, err := tt.New("").ParseFS(fsys, file)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			htmlTmpl, err := ht.New("").ParseFS(fsys, file)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			for _, block := range templateBlocks {
+				if textTmpl.Lookup(block) == nil {
+					return nil, nil, fmt.Errorf("mailer: %s does not define %q", file, block)
+				}
+			}
+
+			byFile[path.Base(file)] = &emailTemplate{text: textTmpl, html: htmlTmpl}
+		}
+
+		templates[strings.ToLower(locale.Name())] = byFile
+		locales = append(locales, locale.Name())
+	}
+
+	return templates, locales, nil
+}
+
+// Send renders templateFile in the user's locale and delivers it.
+func (m *Mailer) Send(recipient, locale, templateFile string, data any) error {
+	msg, err := m.Render(locale, templateFile, data)
 	if err != nil {
 		return err
 	}
 
-	subject := new(bytes.Buffer)
-	err = textTmpl.ExecuteTemplate(subject, "subject", data)
+	msg.To = recipient
+	return m.transport.Send(msg)
+}
+
+// Render renders templateFile without sending it. When the locale has no such
+// template, its parent locales and then the default locale are tried in turn,
+// so "zh-Hant-TW" falls back to "zh-Hant", then "zh".
+func (m *Mailer) Render(locale, templateFile string, data any) (*Message, error) {
+	tmpl, err := m.lookup(locale, templateFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	plainBody := new(bytes.Buffer)
-	err = textTmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	subject := new(bytes.Buffer)
+	err = tmpl.text.ExecuteTemplate(subject, "subject", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	htmlTmpl, err := ht.New("").ParseFS(templateFS, "templates/"+templateFile)
+	plainBody := new(bytes.Buffer)
+	err = tmpl.text.ExecuteTemplate(plainBody, "plainBody", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	htmlBody := new(bytes.Buffer)
-	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	err = tmpl.html.ExecuteTemplate(htmlBody, "htmlBody", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	msg := mail.NewMsg()
-	err = msg.To(recipient)
-	if err != nil {
-		return err
+	return &Message{
+		From:      m.sender,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}, nil
+}
+
+func (m *Mailer) lookup(locale, templateFile string) (*emailTemplate, error) {
+	for _, candidate := range FallbackChain(locale, m.defaultLocale) {
+		if tmpl, ok := m.templates[strings.ToLower(candidate)][templateFile]; ok {
+			return tmpl, nil
+		}
 	}
 
-	err = msg.From(m.sender)
-	if err != nil {
-		return err
+	return nil, fmt.Errorf("%w: %q for locale %q", ErrTemplateNotFound, templateFile, locale)
+}
+
+// Locales lists the locales that have templates, sorted.
+func (m *Mailer) Locales() []string {
+	return slices.Sorted(slices.Values(m.locales))
+}
+
+// Templates lists the template files of a locale, sorted.
+func (m *Mailer) Templates(locale string) []string {
+	byFile := m.templates[strings.ToLower(locale)]
+
+	files := make([]string, 0, len(byFile))
+	for file := range byFile {
+		files = append(files, file)
 	}
 
-	msg.Subject(subject.String())
-	msg.SetBodyString(mail.TypeTextPlain, plainBody.String())
-	msg.AddAlternativeString(mail.TypeTextHTML, htmlBody.String())
+	slices.Sort(files)
+	return files
+}
+
+// FallbackChain lists the locales to try for locale, most specific first and
+// ending with defaultLocale.
+func FallbackChain(locale, defaultLocale string) []string {
+	locale = strings.ReplaceAll(locale, "_", "-")
+
+	var chain []string
+	for locale != "" {
+		chain = append(chain, locale)
+
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
 
-	return m.client.DialAndSend(msg)
+	return append(chain, defaultLocale)
 }
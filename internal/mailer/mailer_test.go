@@ -0,0 +1,136 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var welcomeData = map[string]any{
+	"AppName":       "Knowstro",
+	"UserName":      "alice",
+	"ActivationURL": "https://example.com/activate",
+	"Token":         "ABCDEFGH",
+}
+
+func TestMailerSendMemory(t *testing.T) {
+	transport := NewMemoryTransport()
+	m, err := New(transport, "Knowstro <no-reply@example.com>", DefaultLocale)
+	require.NoError(t, err)
+
+	err = m.Send("alice@example.com", "en", "user_welcome.tmpl", welcomeData)
+	require.NoError(t, err)
+
+	messages := transport.Messages()
+	require.Len(t, messages, 1)
+
+	msg := messages[0]
+	assert.Equal(t, "alice@example.com", msg.To)
+	assert.Equal(t, "Knowstro <no-reply@example.com>", msg.From)
+	assert.Equal(t, "[Knowstro] Activate your account", msg.Subject)
+	assert.Contains(t, msg.PlainBody, "ABCDEFGH")
+	assert.Contains(t, msg.HTMLBody, `href="https://example.com/activate"`)
+}
+
+func TestMailerSendLocaleFallback(t *testing.T) {
+	transport := NewMemoryTransport()
+	m, err := New(transport, "no-reply@example.com", "en")
+	require.NoError(t, err)
+
+	for _, locale := range []string{"zh-Hant", "zh-hant-TW", "zh_Hant_HK", "fr", ""} {
+		err = m.Send("alice@example.com", locale, "user_welcome.tmpl", welcomeData)
+		require.NoError(t, err, "locale=%q", locale)
+	}
+
+	messages := transport.Messages()
+	require.Len(t, messages, 5)
+	for _, msg := range messages[:3] {
+		assert.Equal(t, "【Knowstro】請啟用你的帳號", msg.Subject)
+	}
+	for _, msg := range messages[3:] {
+		assert.Equal(t, "[Knowstro] Activate your account", msg.Subject, "unknown locales use the default")
+	}
+}
+
+func TestFallbackChain(t *testing.T) {
+	assert.Equal(t, []string{"zh-Hant-TW", "zh-Hant", "zh", "en"}, FallbackChain("zh-Hant-TW", "en"))
+	assert.Equal(t, []string{"en-US", "en", "en"}, FallbackChain("en_US", "en"))
+	assert.Equal(t, []string{"zh-Hant"}, FallbackChain("", "zh-Hant"))
+}
+
+func TestNewUnknownDefaultLocale(t *testing.T) {
+	_, err := New(NewMemoryTransport(), "no-reply@example.com", "xx")
+	assert.Error(t, err)
+}
+
+func TestMailerSendUnknownTemplate(t *testing.T) {
+	transport := NewMemoryTransport()
+	m, err := New(transport, "no-reply@example.com", DefaultLocale)
+	require.NoError(t, err)
+
+	err = m.Send("alice@example.com", "en", "missing.tmpl", welcomeData)
+	assert.Error(t, err)
+	assert.Empty(t, transport.Messages())
+}
+
+func TestMaildirTransport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "maildir")
+
+	transport, err := NewMaildirTransport(dir)
+	require.NoError(t, err)
+
+	m, err := New(transport, "no-reply@example.com", DefaultLocale)
+	require.NoError(t, err)
+
+	for range 2 {
+		err = m.Send("alice@example.com", "en", "user_welcome.tmpl", welcomeData)
+		require.NoError(t, err)
+	}
+
+	tmp, err := os.ReadDir(filepath.Join(dir, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, tmp)
+
+	delivered, err := os.ReadDir(filepath.Join(dir, "new"))
+	require.NoError(t, err)
+	require.Len(t, delivered, 2)
+
+	raw, err := os.ReadFile(filepath.Join(dir, "new", delivered[0].Name()))
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), "To: <alice@example.com>")
+}
+
+func TestTemplatesRenderWithSampleData(t *testing.T) {
+	m, err := New(NewMemoryTransport(), "no-reply@example.com", DefaultLocale)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"en", "zh-Hant"}, m.Locales())
+	assert.Equal(t, m.Templates("en"), m.Templates("zh-Hant"), "every locale should have the same templates")
+
+	for _, locale := range m.Locales() {
+		for _, file := range m.Templates(locale) {
+			msg, err := m.Render(locale, file, SampleData())
+			require.NoError(t, err, "%s/%s", locale, file)
+
+			for _, part := range []string{msg.Subject, msg.PlainBody, msg.HTMLBody} {
+				assert.NotEmpty(t, part, "%s/%s", locale, file)
+				assert.NotContains(t, part, "<no value>", "%s/%s uses a field missing from SampleData", locale, file)
+			}
+		}
+	}
+}
+
+func TestParseTemplatesMissingBlock(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/en/ok.tmpl":     {Data: []byte(`{{define "subject"}}s{{end}}{{define "plainBody"}}p{{end}}{{define "htmlBody"}}h{{end}}`)},
+		"templates/en/broken.tmpl": {Data: []byte(`{{define "subject"}}s{{end}}{{define "plainBody"}}p{{end}}`)},
+	}
+
+	_, _, err := parseTemplates(fsys)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `templates/en/broken.tmpl does not define "htmlBody"`)
+}
@@ -0,0 +1,17 @@
+package mailer
+
+// SampleData returns made-up values for every field the templates use, for
+// previewing templates without a real user or token.
+func SampleData() map[string]any {
+	return map[string]any{
+		"AppName":          "Knowstro",
+		"UserName":         "alice",
+		"NewEmail":         "alice@example.com",
+		"Token":            "Y3T2QJ7KXWRM5ZB4HNCLDP6AVE",
+		"ActivationURL":    "https://knowstro.example.com/activate",
+		"PasswordResetURL": "https://knowstro.example.com/password-reset",
+		"ConfirmationURL":  "https://knowstro.example.com/email-change",
+		"Failures":         5,
+		"IPAddress":        "203.0.113.7",
+	}
+}
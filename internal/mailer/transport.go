@@ -0,0 +1,162 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wneessen/go-mail"
+)
+
+// Message is a rendered email, ready to be handed to a Transport.
+type Message struct {
+	From      string `json:"from"`
+	To        string `json:"to,omitzero"`
+	Subject   string `json:"subject"`
+	PlainBody string `json:"plain_body"`
+	HTMLBody  string `json:"html_body"`
+}
+
+func (m *Message) build() (*mail.Msg, error) {
+	msg := mail.NewMsg()
+
+	err := msg.To(m.To)
+	if err != nil {
+		return nil, err
+	}
+
+	err = msg.From(m.From)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Subject(m.Subject)
+	msg.SetBodyString(mail.TypeTextPlain, m.PlainBody)
+	msg.AddAlternativeString(mail.TypeTextHTML, m.HTMLBody)
+
+	return msg, nil
+}
+
+// Transport delivers rendered messages.
+type Transport interface {
+	Send(*Message) error
+}
+
+// SMTPTransport delivers messages through an SMTP server.
+type SMTPTransport struct {
+	client *mail.Client
+}
+
+func NewSMTPTransport(host string, port int, username, password string) (*SMTPTransport, error) {
+	client, err := mail.NewClient(
+		host,
+		mail.WithSMTPAuth(mail.SMTPAuthLogin),
+		mail.WithPort(port),
+		mail.WithUsername(username),
+		mail.WithPassword(password),
+		mail.WithTimeout(5*time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SMTPTransport{client: client}, nil
+}
+
+func (t *SMTPTransport) Send(m *Message) error {
+	msg, err := m.build()
+	if err != nil {
+		return err
+	}
+
+	return t.client.DialAndSend(msg)
+}
+
+// MaildirTransport writes every message into a maildir, for local development
+// without a mail server. Any mail client that reads maildirs can open it.
+type MaildirTransport struct {
+	dir      string
+	hostname string
+	seq      atomic.Uint64
+}
+
+// NewMaildirTransport creates the maildir at dir if it does not exist yet.
+func NewMaildirTransport(dir string) (*MaildirTransport, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0o755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	return &MaildirTransport{dir: dir, hostname: hostname}, nil
+}
+
+// Send writes the message to tmp and then moves it to new, so readers never
+// see a partly written message.
+func (t *MaildirTransport) Send(m *Message) error {
+	msg, err := m.build()
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.P%dQ%d.%s", time.Now().UnixNano(), os.Getpid(), t.seq.Add(1), t.hostname)
+	tmpPath := filepath.Join(t.dir, "tmp", name)
+
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = msg.WriteTo(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, filepath.Join(t.dir, "new", name))
+}
+
+// MemoryTransport keeps sent messages in memory so tests can inspect them.
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+func (t *MemoryTransport) Send(m *Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = append(t.messages, *m)
+	return nil
+}
+
+// Messages returns a copy of every message sent so far, oldest first.
+func (t *MemoryTransport) Messages() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Message(nil), t.messages...)
+}
+
+// NopTransport drops every message.
+type NopTransport struct{}
+
+func (NopTransport) Send(*Message) error {
+	return nil
+}
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"errors"
+	"log/slog"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -11,9 +13,18 @@ import (
 )
 
 type UserMiddleware struct {
-	UserStore store.UserStore
+	UserStore       store.UserStore
+	PermissionStore store.PermissionStore
+	APIKeyStore     store.APIKeyStore
+	// FailedAuthLimiter is charged per client IP for every rejected
+	// credential, since no user is known yet to limit by. Nil disables it.
+	FailedAuthLimiter *RateLimiter
+	Logger            *slog.Logger
 }
 
+// Authenticate resolves the user behind the Authorization header. Clients
+// whose IP has used up its failed-authentication budget are turned away
+// before their credentials are checked.
 func (um *UserMiddleware) Authenticate() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Add("Vary", "Authorization")
@@ -26,9 +37,37 @@ func (um *UserMiddleware) Authenticate() gin.HandlerFunc {
 			return
 		}
 
+		if um.FailedAuthLimiter != nil {
+			if result := um.FailedAuthLimiter.peek("ip:" + c.ClientIP()); !result.allowed {
+				response.RateLimitExceeded(c, result.retryAfter)
+				return
+			}
+		}
+
 		headerParts := strings.Split(authHeader, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			response.InvalidAuthenticationToken(c)
+		if len(headerParts) != 2 {
+			um.rejectCredentials(c)
+			return
+		}
+
+		if headerParts[0] == "ApiKey" {
+			user, key, err := um.APIKeyStore.GetForAPIKey(headerParts[1])
+			if err != nil {
+				if !errors.Is(err, store.ErrRecordNotFound) {
+					um.Logger.Error("get for api key", "error", err)
+				}
+				um.rejectCredentials(c)
+				return
+			}
+
+			c.Request = contexts.SetUser(c.Request, user)
+			c.Request = contexts.SetAPIKey(c.Request, key)
+			c.Next()
+			return
+		}
+
+		if headerParts[0] != "Bearer" {
+			um.rejectCredentials(c)
 			return
 		}
 
@@ -36,11 +75,119 @@ func (um *UserMiddleware) Authenticate() gin.HandlerFunc {
 
 		user, err := um.UserStore.GetForToken(tokens.ScopeAuth, token)
 		if err != nil {
-			response.InvalidAuthenticationToken(c)
+			um.rejectCredentials(c)
 			return
 		}
 
 		c.Request = contexts.SetUser(c.Request, user)
+		c.Request = contexts.SetToken(c.Request, token)
+		c.Next()
+	}
+}
+
+// rejectCredentials answers a request whose credentials were not accepted and
+// charges the failure to the client IP.
+func (um *UserMiddleware) rejectCredentials(c *gin.Context) {
+	if um.FailedAuthLimiter != nil {
+		um.FailedAuthLimiter.allow("ip:" + c.ClientIP())
+	}
+
+	response.InvalidAuthenticationToken(c)
+}
+
+// RequireAuthenticated rejects anonymous requests with 401.
+func (um *UserMiddleware) RequireAuthenticated() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := contexts.GetUser(c.Request)
+
+		if user.IsAnonymous() {
+			response.AuthenticationRequired(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireActivated rejects anonymous requests with 401 and requests from
+// accounts that have not been activated yet with 403.
+func (um *UserMiddleware) RequireActivated() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := contexts.GetUser(c.Request)
+
+		if user.IsAnonymous() {
+			response.AuthenticationRequired(c)
+			return
+		}
+
+		if !user.Activated {
+			response.InactiveAccount(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission only lets activated users holding code through; anyone
+// else is answered with 403. Admin permissions also need two-factor
+// authentication to be enabled.
+func (um *UserMiddleware) RequirePermission(code string) gin.HandlerFunc {
+	requireActivated := um.RequireActivated()
+
+	return func(c *gin.Context) {
+		user := contexts.GetUser(c.Request)
+
+		if user.IsAnonymous() || !user.Activated {
+			requireActivated(c)
+			return
+		}
+
+		permissions, err := um.PermissionStore.GetAllForUser(user.ID)
+		if err != nil {
+			um.Logger.Error("get permissions for user", "error", err)
+			response.InternalError(c)
+			return
+		}
+
+		if !permissions.Include(code) {
+			response.NotPermitted(c)
+			return
+		}
+
+		if store.AdminPermissions.Include(code) && !user.MFAEnabled {
+			response.SecondFactorRequired(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScope rejects requests made with an API key that was not granted
+// scope. Session and anonymous requests are left to the other checks.
+func (um *UserMiddleware) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := contexts.GetAPIKey(c.Request)
+
+		if key != nil && !key.Scopes.Include(scope) {
+			response.MissingAPIKeyScope(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSession rejects requests made with an API key. It guards account
+// management, which no key scope covers.
+func (um *UserMiddleware) RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if contexts.GetAPIKey(c.Request) != nil {
+			response.APIKeyNotAllowed(c)
+			return
+		}
+
 		c.Next()
 	}
 }
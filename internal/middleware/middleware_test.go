@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/y3933y3933/knowstro/internal/contexts"
+	"github.com/y3933y3933/knowstro/internal/store"
+)
+
+func TestAPIKeyGuards(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	um := &UserMiddleware{}
+	key := &store.APIKey{Scopes: store.Permissions{store.APIKeyScopeResourcesRead}}
+
+	tests := []struct {
+		name  string
+		key   *store.APIKey
+		guard gin.HandlerFunc
+		want  int
+	}{
+		{"session passes scope check", nil, um.RequireScope(store.APIKeyScopeResourcesWrite), http.StatusOK},
+		{"key with scope", key, um.RequireScope(store.APIKeyScopeResourcesRead), http.StatusOK},
+		{"key without scope", key, um.RequireScope(store.APIKeyScopeResourcesWrite), http.StatusForbidden},
+		{"session passes session check", nil, um.RequireSession(), http.StatusOK},
+		{"key on session route", key, um.RequireSession(), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				if tt.key != nil {
+					c.Request = contexts.SetAPIKey(c.Request, tt.key)
+				}
+				c.Next()
+			})
+			r.GET("/", tt.guard, func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestAuthenticateLimitsFailedCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	um := &UserMiddleware{FailedAuthLimiter: NewRateLimiter(0.01, 2)}
+
+	r := gin.New()
+	err := r.SetTrustedProxies(nil)
+	assert.NoError(t, err)
+	r.Use(um.Authenticate())
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	codes := []int{}
+	for i := range 4 {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.7:4711"
+		req.Header.Set("Authorization", "Basic Z2FyYmFnZQ==")
+		if i == 3 {
+			req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		}
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	assert.Equal(t, []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests}, codes)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "anonymous requests are not charged")
+}
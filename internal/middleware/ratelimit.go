@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"hash/maphash"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y3933y3933/knowstro/internal/contexts"
+	"github.com/y3933y3933/knowstro/internal/response"
+)
+
+// RateLimitConfig sets the token bucket every client gets: Burst requests at
+// once, refilled at Rate requests per second.
+type RateLimitConfig struct {
+	Enabled bool
+	Rate    float64
+	Burst   int
+}
+
+// WithLimit keeps the enabled switch but replaces the rate and burst, so route
+// groups can tighten the global limit.
+func (rc RateLimitConfig) WithLimit(rate float64, burst int) RateLimitConfig {
+	rc.Rate = rate
+	rc.Burst = burst
+	return rc
+}
+
+const (
+	rateLimitShards = 64
+	// rateLimitSweepInterval is how often a shard drops its idle buckets.
+	rateLimitSweepInterval = time.Minute
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimitShard owns a slice of the buckets so concurrent requests for
+// different clients rarely contend on the same lock.
+type rateLimitShard struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// RateLimiter hands out a token bucket per client key.
+type RateLimiter struct {
+	rate   float64
+	burst  int
+	seed   maphash.Seed
+	shards [rateLimitShards]rateLimitShard
+	now    func() time.Time
+}
+
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	rl := &RateLimiter{
+		rate:  rate,
+		burst: burst,
+		seed:  maphash.MakeSeed(),
+		now:   time.Now,
+	}
+
+	for i := range rl.shards {
+		rl.shards[i].buckets = map[string]*bucket{}
+	}
+
+	return rl
+}
+
+// rateLimitResult describes the bucket of one client after a request.
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+	reset      time.Duration
+}
+
+// allow takes a token from the bucket of key if one is available.
+func (rl *RateLimiter) allow(key string) rateLimitResult {
+	return rl.take(key, 1)
+}
+
+// peek reports whether the bucket of key has a token without taking it.
+func (rl *RateLimiter) peek(key string) rateLimitResult {
+	return rl.take(key, 0)
+}
+
+func (rl *RateLimiter) take(key string, cost float64) rateLimitResult {
+	now := rl.now()
+	shard := &rl.shards[maphash.String(rl.seed, key)%rateLimitShards]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	rl.sweep(shard, now)
+
+	b, ok := shard.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rl.burst), last: now}
+		shard.buckets[key] = b
+	}
+
+	b.tokens = min(float64(rl.burst), b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+
+	result := rateLimitResult{}
+	if b.tokens >= 1 {
+		b.tokens -= cost
+		result.allowed = true
+	} else {
+		result.retryAfter = rl.refillTime(1 - b.tokens)
+	}
+
+	result.remaining = int(b.tokens)
+	result.reset = rl.refillTime(float64(rl.burst) - b.tokens)
+	return result
+}
+
+func (rl *RateLimiter) refillTime(tokens float64) time.Duration {
+	return time.Duration(tokens / rl.rate * float64(time.Second))
+}
+
+// sweep drops the buckets of a shard that would have refilled completely, at
+// most once per interval. The caller must hold shard.mu.
+func (rl *RateLimiter) sweep(shard *rateLimitShard, now time.Time) {
+	if now.Sub(shard.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	shard.lastSweep = now
+
+	idle := rl.refillTime(float64(rl.burst))
+	for key, b := range shard.buckets {
+		if now.Sub(b.last) >= idle {
+			delete(shard.buckets, key)
+		}
+	}
+}
+
+// RateLimit limits each client to the configured token bucket. Authenticated
+// users are limited by user ID and anonymous callers by client IP, which the
+// engine only takes from X-Forwarded-For when a trusted proxy sent it. Every
+// call creates its own set of buckets, so a route group's limit applies on top
+// of the global one.
+func RateLimit(cfg RateLimitConfig) gin.HandlerFunc {
+	if !cfg.Enabled {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	limiter := NewRateLimiter(cfg.Rate, cfg.Burst)
+
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if user := contexts.GetUser(c.Request); !user.IsAnonymous() {
+			key = "user:" + strconv.Itoa(user.ID)
+		}
+
+		result := limiter.allow(key)
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(cfg.Burst))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.reset.Seconds()))))
+
+		if !result.allowed {
+			response.RateLimitExceeded(c, result.retryAfter)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// NewFailedAuthLimiter returns the limiter Authenticate charges for every
+// rejected credential, or nil when rate limiting is disabled.
+func NewFailedAuthLimiter(cfg RateLimitConfig) *RateLimiter {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	return NewRateLimiter(cfg.Rate, cfg.Burst)
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/y3933y3933/knowstro/internal/contexts"
+	"github.com/y3933y3933/knowstro/internal/store"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(1, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 2; i >= 0; i-- {
+		result := limiter.allow("ip:10.0.0.1")
+		assert.True(t, result.allowed)
+		assert.Equal(t, i, result.remaining)
+	}
+
+	result := limiter.allow("ip:10.0.0.1")
+	assert.False(t, result.allowed)
+	assert.Equal(t, time.Second, result.retryAfter)
+	assert.Equal(t, 3*time.Second, result.reset)
+
+	assert.True(t, limiter.allow("ip:10.0.0.2").allowed, "buckets are per key")
+
+	now = now.Add(time.Second)
+	assert.True(t, limiter.allow("ip:10.0.0.1").allowed, "a token refills after a second")
+	assert.False(t, limiter.allow("ip:10.0.0.1").allowed)
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(1, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := range 200 {
+		limiter.allow(fmt.Sprintf("ip:10.0.%d.%d", i/256, i%256))
+	}
+
+	now = now.Add(2 * rateLimitSweepInterval)
+	for i := range limiter.shards {
+		shard := &limiter.shards[i]
+		shard.mu.Lock()
+		limiter.sweep(shard, now)
+		assert.Empty(t, shard.buckets)
+		shard.mu.Unlock()
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Request = contexts.SetUser(c.Request, store.AnonymousUser)
+		c.Next()
+	})
+	r.Use(RateLimit(RateLimitConfig{Enabled: true, Rate: 1, Burst: 2}))
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	codes := []int{}
+	for range 3 {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes = append(codes, rec.Code)
+
+		assert.Equal(t, "2", rec.Header().Get("X-RateLimit-Limit"))
+		if rec.Code == http.StatusTooManyRequests {
+			assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+		}
+	}
+
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	err := r.SetTrustedProxies(nil)
+	assert.NoError(t, err)
+	r.Use(func(c *gin.Context) {
+		c.Request = contexts.SetUser(c.Request, store.AnonymousUser)
+		c.Next()
+	})
+	r.Use(RateLimit(RateLimitConfig{Enabled: true, Rate: 1, Burst: 1}))
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	codes := []int{}
+	for _, forwardedFor := range []string{"", "198.51.100.1"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.7:4711"
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	assert.Equal(t, []int{http.StatusOK, http.StatusTooManyRequests}, codes)
+}
@@ -0,0 +1,144 @@
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// standInProvider is a minimal OpenID Connect server. It issues one
+// authorization code bound to a PKCE challenge and nonce.
+type standInProvider struct {
+	server    *httptest.Server
+	code      string
+	challenge string
+	nonce     string
+	audience  string
+	email     string
+}
+
+func newStandInProvider(t *testing.T) *standInProvider {
+	sp := &standInProvider{code: "the-code", audience: "knowstro", email: "alice@example.com"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 sp.server.URL,
+			"authorization_endpoint": sp.server.URL + "/authorize",
+			"token_endpoint":         sp.server.URL + "/token",
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "knowstro" || secret != "s3cret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+
+		if r.PostFormValue("code") != sp.code || CodeChallenge(r.PostFormValue("code_verifier")) != sp.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		claims, _ := json.Marshal(map[string]any{
+			"iss":            sp.server.URL,
+			"sub":            "user-42",
+			"aud":            []string{sp.audience},
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"nonce":          sp.nonce,
+			"email":          sp.email,
+			"email_verified": true,
+			"name":           "Alice",
+		})
+		idToken := "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(claims) + ".c2lnbmF0dXJl"
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     idToken,
+		})
+	})
+
+	sp.server = httptest.NewTLSServer(mux)
+	t.Cleanup(sp.server.Close)
+	return sp
+}
+
+func (sp *standInProvider) provider(t *testing.T) *GenericProvider {
+	p, err := NewProvider(context.Background(), Config{
+		Name:         "sso",
+		Issuer:       sp.server.URL,
+		ClientID:     "knowstro",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://knowstro.example/v1/oidc/sso/callback",
+	}, sp.server.Client())
+	require.NoError(t, err)
+	return p
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	sp := newStandInProvider(t)
+	p := sp.provider(t)
+
+	authURL, err := url.Parse(p.AuthCodeURL("state", "nonce", "challenge"))
+	require.NoError(t, err)
+
+	query := authURL.Query()
+	assert.Equal(t, sp.server.URL+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, "knowstro", query.Get("client_id"))
+	assert.Equal(t, "state", query.Get("state"))
+	assert.Equal(t, "nonce", query.Get("nonce"))
+	assert.Equal(t, "challenge", query.Get("code_challenge"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, "openid email profile", query.Get("scope"))
+}
+
+func TestExchange(t *testing.T) {
+	sp := newStandInProvider(t)
+	p := sp.provider(t)
+
+	verifier, err := RandomString()
+	require.NoError(t, err)
+	sp.challenge = CodeChallenge(verifier)
+	sp.nonce = "nonce-1"
+
+	identity, err := p.Exchange(context.Background(), sp.code, verifier, "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{Subject: "user-42", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}, identity)
+
+	_, err = p.Exchange(context.Background(), sp.code, "wrong-verifier", "nonce-1")
+	assert.ErrorIs(t, err, ErrExchangeFailed, "PKCE verifier must match")
+
+	_, err = p.Exchange(context.Background(), sp.code, verifier, "other-nonce")
+	assert.ErrorIs(t, err, ErrInvalidIDToken, "nonce must match")
+
+	sp.audience = "someone-else"
+	_, err = p.Exchange(context.Background(), sp.code, verifier, "nonce-1")
+	assert.ErrorIs(t, err, ErrInvalidIDToken, "audience must match")
+}
+
+func TestNewProviderRequiresHTTPS(t *testing.T) {
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+		})
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	_, err := NewProvider(context.Background(), Config{Name: "plain", Issuer: server.URL}, server.Client())
+	assert.Error(t, err)
+}
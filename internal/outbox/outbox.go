@@ -0,0 +1,213 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/y3933y3933/knowstro/internal/store"
+)
+
+// Sender delivers one email. *mailer.Mailer satisfies it.
+type Sender interface {
+	Send(recipient, locale, templateFile string, data any) error
+}
+
+type Config struct {
+	// Workers is how many goroutines drain the outbox concurrently.
+	Workers int
+	// BatchSize is how many emails a worker claims at a time.
+	BatchSize int
+	// PollInterval is how long an idle worker waits before looking again.
+	PollInterval time.Duration
+	// Lease is how long a claimed email is reserved for its worker. It must
+	// comfortably cover sending a whole batch, or emails may be sent twice.
+	Lease time.Duration
+	// MaxAttempts is how many sends are tried before an email is dead.
+	MaxAttempts int
+	// BaseDelay is the wait after the first failed attempt. It doubles with
+	// every further failure, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// DeadRetention is how long a dead email keeps its template data for an
+	// admin to requeue it. The data may hold tokens, so it should not
+	// outlive the longest token lifetime by much.
+	DeadRetention time.Duration
+}
+
+var DefaultConfig = Config{
+	Workers:      2,
+	BatchSize:    10,
+	PollInterval: 5 * time.Second,
+	Lease:        5 * time.Minute,
+	MaxAttempts:  8,
+	BaseDelay:    30 * time.Second,
+	MaxDelay:     time.Hour,
+	// Activation tokens, the longest-lived ones mailed, last three days.
+	DeadRetention: 72 * time.Hour,
+}
+
+// Backoff returns how long to wait before retrying an email that has failed
+// the given number of attempts.
+func (c Config) Backoff(attempts int) time.Duration {
+	delay := c.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= c.MaxDelay {
+			return c.MaxDelay
+		}
+	}
+	return min(delay, c.MaxDelay)
+}
+
+// Worker sends the emails queued in the outbox, retrying failures with
+// exponential backoff until they are sent or run out of attempts.
+type Worker struct {
+	store  store.OutboxStore
+	sender Sender
+	cfg    Config
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+func NewWorker(store store.OutboxStore, sender Sender, cfg Config, logger *slog.Logger) *Worker {
+	return &Worker{
+		store:  store,
+		sender: sender,
+		cfg:    cfg,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// purgeInterval is how often the data of expired dead emails is purged.
+const purgeInterval = time.Hour
+
+// Run drains the outbox until ctx is cancelled and every worker has finished
+// the email it was sending. Meanwhile it purges the data of dead emails that
+// are past DeadRetention.
+func (w *Worker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.purge(ctx)
+	}()
+
+	for range max(w.cfg.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.poll(ctx)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (w *Worker) poll(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// A full batch suggests there is more waiting, so keep going without
+		// waiting for the next tick.
+		for ctx.Err() == nil {
+			claimed, err := w.ProcessBatch(ctx)
+			if err != nil {
+				w.logger.Error("processing outbox", "error", err)
+				break
+			}
+			if claimed < w.cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) purge(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.PurgeDeadData(); err != nil {
+			w.logger.Error("purging dead emails", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeDeadData drops the data of dead emails older than DeadRetention.
+func (w *Worker) PurgeDeadData() error {
+	purged, err := w.store.PurgeDeadData(w.now().Add(-w.cfg.DeadRetention))
+	if err != nil {
+		return err
+	}
+
+	if purged > 0 {
+		w.logger.Info("purged dead emails", "count", purged)
+	}
+	return nil
+}
+
+// ProcessBatch claims one batch of due emails and tries to send each of them.
+// It returns how many emails were claimed. Once ctx is cancelled it stops
+// between emails; the rest are sent again when their lease runs out.
+func (w *Worker) ProcessBatch(ctx context.Context) (int, error) {
+	emails, err := w.store.ClaimEmails(w.cfg.BatchSize, w.cfg.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, email := range emails {
+		if ctx.Err() != nil {
+			break
+		}
+		w.deliver(email)
+	}
+
+	return len(emails), nil
+}
+
+func (w *Worker) deliver(email *store.OutboxEmail) {
+	var data map[string]any
+
+	// Numbers are kept as json.Number so templates print them as written.
+	dec := json.NewDecoder(bytes.NewReader(email.Data))
+	dec.UseNumber()
+
+	err := dec.Decode(&data)
+	if err == nil {
+		err = w.sender.Send(email.Recipient, email.Locale, email.Template, data)
+	}
+
+	switch {
+	case err == nil:
+		err = w.store.MarkSent(email.ID)
+	case email.Attempts >= w.cfg.MaxAttempts:
+		w.logger.Error("giving up on email", "id", email.ID, "attempts", email.Attempts, "error", err)
+		err = w.store.MarkDead(email.ID, err.Error())
+	default:
+		w.logger.Warn("sending email", "id", email.ID, "attempts", email.Attempts, "error", err)
+		err = w.store.MarkFailed(email.ID, err.Error(), w.now().Add(w.cfg.Backoff(email.Attempts)))
+	}
+
+	if err != nil {
+		w.logger.Error("updating outbox email", "id", email.ID, "error", err)
+	}
+}
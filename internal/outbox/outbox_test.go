@@ -0,0 +1,166 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y3933y3933/knowstro/internal/store"
+)
+
+type fakeStore struct {
+	store.OutboxStore
+	due    []*store.OutboxEmail
+	sent   []int64
+	failed map[int64]time.Time
+	dead   map[int64]string
+	purged time.Time
+}
+
+func (s *fakeStore) ClaimEmails(limit int, lease time.Duration) ([]*store.OutboxEmail, error) {
+	n := min(limit, len(s.due))
+	claimed := s.due[:n]
+	s.due = s.due[n:]
+	for _, email := range claimed {
+		email.Attempts++
+	}
+	return claimed, nil
+}
+
+func (s *fakeStore) MarkSent(id int64) error {
+	s.sent = append(s.sent, id)
+	return nil
+}
+
+func (s *fakeStore) MarkFailed(id int64, sendErr string, nextAttemptAt time.Time) error {
+	s.failed[id] = nextAttemptAt
+	return nil
+}
+
+func (s *fakeStore) MarkDead(id int64, sendErr string) error {
+	s.dead[id] = sendErr
+	return nil
+}
+
+func (s *fakeStore) PurgeDeadData(before time.Time) (int64, error) {
+	s.purged = before
+	return 0, nil
+}
+
+type sent struct {
+	recipient string
+	template  string
+	data      any
+}
+
+type fakeSender struct {
+	fail map[string]bool
+	sent []sent
+}
+
+func (s *fakeSender) Send(recipient, locale, templateFile string, data any) error {
+	if s.fail[recipient] {
+		return errors.New("smtp unavailable")
+	}
+	s.sent = append(s.sent, sent{recipient, templateFile, data})
+	return nil
+}
+
+func TestConfigBackoff(t *testing.T) {
+	cfg := Config{BaseDelay: 30 * time.Second, MaxDelay: 5 * time.Minute}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{5, 5 * time.Minute},
+		{50, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, cfg.Backoff(tt.attempts), "attempts=%d", tt.attempts)
+	}
+}
+
+func TestWorkerProcessBatch(t *testing.T) {
+	newEmail := func(id int64, recipient string, attempts int) *store.OutboxEmail {
+		email, err := store.NewOutboxEmail(recipient, "en", "user_welcome.tmpl", map[string]any{"UserName": "alice", "Failures": 5})
+		require.NoError(t, err)
+		email.ID = id
+		email.Attempts = attempts
+		return email
+	}
+
+	st := &fakeStore{
+		due: []*store.OutboxEmail{
+			newEmail(1, "ok@example.com", 0),
+			newEmail(2, "down@example.com", 0),
+			newEmail(3, "down@example.com", 2),
+			newEmail(4, "ok@example.com", 0),
+		},
+		failed: map[int64]time.Time{},
+		dead:   map[int64]string{},
+	}
+	sender := &fakeSender{fail: map[string]bool{"down@example.com": true}}
+
+	cfg := Config{BatchSize: 3, MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+	worker := NewWorker(st, sender, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	worker.now = func() time.Time { return now }
+
+	claimed, err := worker.ProcessBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, claimed)
+
+	assert.Equal(t, []int64{1}, st.sent)
+	assert.Equal(t, map[int64]time.Time{2: now.Add(time.Minute)}, st.failed)
+	assert.Equal(t, map[int64]string{3: "smtp unavailable"}, st.dead, "third failed attempt is the last")
+
+	require.Len(t, sender.sent, 1)
+	data := sender.sent[0].data.(map[string]any)
+	assert.Equal(t, "alice", data["UserName"])
+	assert.Equal(t, json.Number("5"), data["Failures"])
+
+	claimed, err = worker.ProcessBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, claimed)
+	assert.Equal(t, []int64{1, 4}, st.sent)
+}
+
+func TestWorkerPurgeDeadData(t *testing.T) {
+	st := &fakeStore{}
+	worker := NewWorker(st, &fakeSender{}, Config{DeadRetention: 72 * time.Hour}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	now := time.Date(2025, 1, 4, 12, 0, 0, 0, time.UTC)
+	worker.now = func() time.Time { return now }
+
+	require.NoError(t, worker.PurgeDeadData())
+	assert.Equal(t, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), st.purged)
+}
+
+func TestWorkerProcessBatchStopsWhenCancelled(t *testing.T) {
+	email, err := store.NewOutboxEmail("ok@example.com", "en", "user_welcome.tmpl", map[string]any{"UserName": "alice"})
+	require.NoError(t, err)
+
+	st := &fakeStore{due: []*store.OutboxEmail{email}}
+	sender := &fakeSender{}
+	worker := NewWorker(st, sender, Config{BatchSize: 10, MaxAttempts: 3}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	claimed, err := worker.ProcessBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, claimed)
+	assert.Empty(t, sender.sent, "the claimed email is left to its lease")
+	assert.Empty(t, st.sent)
+}
@@ -1,7 +1,10 @@
 package response
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,6 +15,16 @@ const (
 	MsgFailedValidation           = "validation fail"
 	MsgInvalidCredentials         = "invalid authentication credentials"
 	MsgInvalidAuthenticationToken = "invalid or missing authentication token"
+	MsgAuthenticationRequired     = "you must be authenticated to access this resource"
+	MsgNotPermitted               = "your user account doesn't have the necessary permissions to access this resource"
+	MsgInactiveAccount            = "your user account must be activated to access this resource"
+	MsgEditConflict               = "unable to update the record due to an edit conflict, please try again"
+	MsgTooManyLoginAttempts       = "too many failed login attempts, please try again later"
+	MsgRateLimitExceeded          = "rate limit exceeded"
+	MsgInvalidSecondFactor        = "invalid two-factor authentication code"
+	MsgSecondFactorRequired       = "your user account must have two-factor authentication enabled to access this resource"
+	MsgMissingAPIKeyScope         = "your api key doesn't have the necessary scope to access this resource"
+	MsgAPIKeyNotAllowed           = "this resource cannot be accessed with an api key"
 )
 
 func SuccessOK(c *gin.Context, data any) {
@@ -19,11 +32,21 @@ func SuccessOK(c *gin.Context, data any) {
 	c.JSON(status, res)
 }
 
+func SuccessList(c *gin.Context, data any, metadata any) {
+	status, res := NewSuccessWithMetadata(http.StatusOK, data, metadata)
+	c.JSON(status, res)
+}
+
 func SuccessCreated(c *gin.Context, data any) {
 	status, res := NewSuccess(http.StatusCreated, data)
 	c.JSON(status, res)
 }
 
+func SuccessAccepted(c *gin.Context, data any) {
+	status, res := NewSuccess(http.StatusAccepted, data)
+	c.JSON(status, res)
+}
+
 func RecordNotFound(c *gin.Context) {
 	status, res := NewError(http.StatusNotFound, MsgRecordNotFound)
 	c.AbortWithStatusJSON(status, res)
@@ -59,3 +82,61 @@ func InvalidAuthenticationToken(c *gin.Context) {
 	status, res := NewError(http.StatusUnauthorized, MsgInvalidAuthenticationToken)
 	c.AbortWithStatusJSON(status, res)
 }
+
+func AuthenticationRequired(c *gin.Context) {
+	status, res := NewError(http.StatusUnauthorized, MsgAuthenticationRequired)
+	c.AbortWithStatusJSON(status, res)
+}
+
+func NotPermitted(c *gin.Context) {
+	status, res := NewError(http.StatusForbidden, MsgNotPermitted)
+	c.AbortWithStatusJSON(status, res)
+}
+
+func InactiveAccount(c *gin.Context) {
+	status, res := NewError(http.StatusForbidden, MsgInactiveAccount)
+	c.AbortWithStatusJSON(status, res)
+}
+
+func EditConflict(c *gin.Context) {
+	status, res := NewError(http.StatusConflict, MsgEditConflict)
+	c.AbortWithStatusJSON(status, res)
+}
+
+// TooManyLoginAttempts rejects a login while the account or client is locked
+// out.
+func TooManyLoginAttempts(c *gin.Context, retryAfter time.Duration) {
+	tooManyRequests(c, MsgTooManyLoginAttempts, retryAfter)
+}
+
+func RateLimitExceeded(c *gin.Context, retryAfter time.Duration) {
+	tooManyRequests(c, MsgRateLimitExceeded, retryAfter)
+}
+
+// tooManyRequests responds with 429 and tells the client in whole seconds when
+// it may retry.
+func tooManyRequests(c *gin.Context, message string, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	status, res := NewError(http.StatusTooManyRequests, message)
+	c.AbortWithStatusJSON(status, res)
+}
+
+func InvalidSecondFactor(c *gin.Context) {
+	status, res := NewError(http.StatusUnauthorized, MsgInvalidSecondFactor)
+	c.AbortWithStatusJSON(status, res)
+}
+
+func SecondFactorRequired(c *gin.Context) {
+	status, res := NewError(http.StatusForbidden, MsgSecondFactorRequired)
+	c.AbortWithStatusJSON(status, res)
+}
+
+func MissingAPIKeyScope(c *gin.Context) {
+	status, res := NewError(http.StatusForbidden, MsgMissingAPIKeyScope)
+	c.AbortWithStatusJSON(status, res)
+}
+
+func APIKeyNotAllowed(c *gin.Context) {
+	status, res := NewError(http.StatusForbidden, MsgAPIKeyNotAllowed)
+	c.AbortWithStatusJSON(status, res)
+}
@@ -1,9 +1,10 @@
 package response
 
 type Response[T any] struct {
-	Success bool      `json:"success"`
-	Data    *T        `json:"data,omitzero"`
-	Error   *APIError `json:"error,omitzero"`
+	Success  bool      `json:"success"`
+	Data     *T        `json:"data,omitzero"`
+	Metadata any       `json:"metadata,omitzero"`
+	Error    *APIError `json:"error,omitzero"`
 }
 
 type APIError struct {
@@ -23,6 +24,14 @@ func NewSuccess[T any](status int, data T) (int, Response[T]) {
 	}
 }
 
+func NewSuccessWithMetadata[T any](status int, data T, metadata any) (int, Response[T]) {
+	return status, Response[T]{
+		Success:  true,
+		Data:     &data,
+		Metadata: metadata,
+	}
+}
+
 func NewError(code int, msg string, details ...FieldError) (int, Response[any]) {
 	return code, Response[any]{
 		Success: false,
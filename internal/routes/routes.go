@@ -5,17 +5,28 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/y3933y3933/knowstro/internal/app"
+	"github.com/y3933y3933/knowstro/internal/middleware"
+	"github.com/y3933y3933/knowstro/internal/store"
 )
 
-func SetupRoutes(app *app.Application) *gin.Engine {
+// SetupRoutes builds the router. Client IPs come from the connection unless
+// it is one of the configured trusted proxies, so X-Forwarded-For cannot be
+// forged to dodge per-IP limits.
+func SetupRoutes(app *app.Application) (*gin.Engine, error) {
 	r := gin.Default()
 
+	err := r.SetTrustedProxies(app.Config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	r.Use(func(c *gin.Context) {
 		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 1<<20)
 		c.Next()
 	})
 
 	r.Use(app.UserMiddleware.Authenticate())
+	r.Use(middleware.RateLimit(app.Config.Limiter))
 
 	{
 		v1 := r.Group("v1")
@@ -24,27 +35,133 @@ func SetupRoutes(app *app.Application) *gin.Engine {
 			{
 				types := v1.Group("/types")
 				types.GET("/:id", app.ResourceTypeHandler.GetTypeByID)
-				types.POST("", app.ResourceTypeHandler.CreateType)
-				types.PUT("/:id", app.ResourceTypeHandler.UpdateType)
-				types.DELETE("/:id", app.ResourceTypeHandler.DeleteType)
 				types.GET("", app.ResourceTypeHandler.ListTypes)
-				types.DELETE("/reset", app.ResourceTypeHandler.ResetTypes)
+
+				curators := types.Group("", app.UserMiddleware.RequireSession(), app.UserMiddleware.RequirePermission(store.PermissionTypesWrite))
+				curators.POST("", app.ResourceTypeHandler.CreateType)
+				curators.PUT("/:id", app.ResourceTypeHandler.UpdateType)
+				curators.DELETE("/:id", app.ResourceTypeHandler.DeleteType)
+
+				admins := types.Group("", app.UserMiddleware.RequireSession(), app.UserMiddleware.RequirePermission(store.PermissionTypesReset))
+				admins.DELETE("/reset", app.ResourceTypeHandler.ResetTypes)
 			}
 
 			{
-				users := v1.Group("/users")
+				resources := v1.Group("/resources")
+
+				readers := resources.Group("", app.UserMiddleware.RequireScope(store.APIKeyScopeResourcesRead))
+				readers.GET("/search", middleware.RateLimit(app.Config.Limiter.WithLimit(1, 5)), app.ResourceHandler.SearchResources)
+				readers.GET("/:id", app.ResourceHandler.GetResourceByID)
+				readers.GET("", app.ResourceHandler.ListResources)
+				readers.GET("/:id/comments", app.CommentHandler.ListComments)
+
+				activated := resources.Group("", app.UserMiddleware.RequireActivated())
+
+				writers := activated.Group("", app.UserMiddleware.RequireScope(store.APIKeyScopeResourcesWrite))
+				writers.POST("", app.ResourceHandler.CreateResource)
+				writers.PUT("/:id", app.ResourceHandler.UpdateResource)
+				writers.DELETE("/:id", app.ResourceHandler.DeleteResource)
+				writers.PUT("/:id/subjects", app.ResourceHandler.SetSubjects)
+				writers.POST("/:id/subjects", app.ResourceHandler.AddSubjects)
+				writers.DELETE("/:id/subjects/:subject_id", app.ResourceHandler.RemoveSubject)
+				writers.PUT("/:id/tags", app.ResourceHandler.SetTags)
+				writers.POST("/:id/tags", app.ResourceHandler.AddTags)
+				writers.DELETE("/:id/tags/:tag_id", app.ResourceHandler.RemoveTag)
+
+				favoriters := activated.Group("", app.UserMiddleware.RequireScope(store.APIKeyScopeFavoritesWrite))
+				favoriters.POST("/:id/favorite", app.FavoriteHandler.AddFavorite)
+				favoriters.DELETE("/:id/favorite", app.FavoriteHandler.RemoveFavorite)
+
+				commenters := activated.Group("", app.UserMiddleware.RequireScope(store.APIKeyScopeCommentsWrite))
+				commenters.POST("/:id/comments", app.CommentHandler.CreateComment)
+			}
+
+			{
+				comments := v1.Group("/comments", app.UserMiddleware.RequireActivated(), app.UserMiddleware.RequireScope(store.APIKeyScopeCommentsWrite))
+				comments.PUT("/:id", app.CommentHandler.UpdateComment)
+				comments.DELETE("/:id", app.CommentHandler.DeleteComment)
+			}
+
+			{
+				subjects := v1.Group("/subjects")
+				subjects.GET("/:id", app.SubjectHandler.GetByID)
+				subjects.GET("", app.SubjectHandler.List)
+
+				curators := subjects.Group("", app.UserMiddleware.RequireSession(), app.UserMiddleware.RequirePermission(store.PermissionSubjectsWrite))
+				curators.POST("", app.SubjectHandler.Create)
+				curators.PUT("/:id", app.SubjectHandler.Update)
+				curators.DELETE("/:id", app.SubjectHandler.Delete)
+			}
+
+			{
+				tags := v1.Group("/tags")
+				tags.GET("/:id", app.TagHandler.GetByID)
+				tags.GET("", app.TagHandler.List)
+
+				curators := tags.Group("", app.UserMiddleware.RequireSession(), app.UserMiddleware.RequirePermission(store.PermissionTagsWrite))
+				curators.POST("", app.TagHandler.Create)
+				curators.PUT("/:id", app.TagHandler.Update)
+				curators.DELETE("/:id", app.TagHandler.Delete)
+			}
+
+			{
+				users := v1.Group("/users", middleware.RateLimit(app.Config.Limiter.WithLimit(0.5, 10)))
 				users.POST("", app.UserHandler.HandleRegisterUser)
 				users.PUT("/activated", app.UserHandler.HandlerActivateUser)
+				users.PUT("/password", app.UserHandler.HandleUpdateUserPassword)
+				users.PUT("/email", app.UserHandler.HandleConfirmEmailChange)
+
+				authenticated := users.Group("", app.UserMiddleware.RequireAuthenticated())
+				authenticated.GET("/me", app.UserMiddleware.RequireScope(store.APIKeyScopeProfileRead), app.UserHandler.HandleGetCurrentUser)
+				authenticated.GET("/me/favorites", app.UserMiddleware.RequireScope(store.APIKeyScopeFavoritesRead), app.FavoriteHandler.ListFavorites)
+
+				account := authenticated.Group("", app.UserMiddleware.RequireSession())
+				account.PATCH("/me", app.UserHandler.HandleUpdateCurrentUser)
+				account.DELETE("/me", app.UserHandler.HandleDeleteCurrentUser)
+				account.GET("/me/export", app.UserHandler.HandleExportCurrentUser)
+				account.POST("/me/mfa/totp", app.MFAHandler.HandleEnrollTOTP)
+				account.POST("/me/mfa/totp/confirm", app.MFAHandler.HandleConfirmTOTP)
+				account.DELETE("/me/mfa/totp", app.MFAHandler.HandleDisableTOTP)
+				account.GET("/me/api-keys", app.APIKeyHandler.ListAPIKeys)
+				account.POST("/me/api-keys", app.APIKeyHandler.CreateAPIKey)
+				account.DELETE("/me/api-keys/:id", app.APIKeyHandler.DeleteAPIKey)
+
+				admins := users.Group("", app.UserMiddleware.RequireSession(), app.UserMiddleware.RequirePermission(store.PermissionPermissionsWrite))
+				admins.GET("/:id/permissions", app.PermissionHandler.ListPermissions)
+				admins.PUT("/:id/permissions", app.PermissionHandler.GrantPermissions)
+				admins.DELETE("/:id/permissions/:code", app.PermissionHandler.RevokePermission)
 			}
 
 			{
-				tokens := v1.Group("tokens")
+				tokens := v1.Group("tokens", middleware.RateLimit(app.Config.Limiter.WithLimit(0.2, 5)))
 				tokens.POST("/authentication", app.TokenHandler.HandleCreateToken)
+				tokens.POST("/password-reset", app.TokenHandler.HandleCreatePasswordResetToken)
+				tokens.POST("/activation", app.TokenHandler.HandleCreateActivationToken)
+				tokens.POST("/mfa", app.TokenHandler.HandleCreateMFAToken)
+
+				authenticated := tokens.Group("", app.UserMiddleware.RequireAuthenticated(), app.UserMiddleware.RequireSession())
+				authenticated.DELETE("/authentication", app.TokenHandler.HandleDeleteToken)
+				authenticated.DELETE("/authentication/all", app.TokenHandler.HandleDeleteAllTokens)
+			}
+
+			{
+				oidc := v1.Group("/oidc", middleware.RateLimit(app.Config.Limiter.WithLimit(0.2, 5)))
+				oidc.GET("/:provider/login", app.OIDCHandler.HandleLogin)
+				oidc.GET("/:provider/callback", app.OIDCHandler.HandleCallback)
+			}
+
+			{
+				emails := v1.Group("/emails", app.UserMiddleware.RequireSession(), app.UserMiddleware.RequirePermission(store.PermissionEmailsManage))
+				emails.GET("", app.EmailHandler.ListEmails)
+				emails.GET("/templates", app.EmailHandler.ListTemplates)
+				emails.GET("/templates/:name", app.EmailHandler.PreviewTemplate)
+				emails.GET("/:id", app.EmailHandler.GetEmail)
+				emails.POST("/:id/requeue", app.EmailHandler.RequeueEmail)
 			}
 
 		}
 
 	}
 
-	return r
+	return r, nil
 }
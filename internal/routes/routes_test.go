@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y3933y3933/knowstro/internal/api"
+	"github.com/y3933y3933/knowstro/internal/app"
+	"github.com/y3933y3933/knowstro/internal/middleware"
+	"github.com/y3933y3933/knowstro/internal/store"
+	"github.com/y3933y3933/knowstro/internal/throttle"
+)
+
+func TestLoginThrottleIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   string
+	}{
+		{
+			name:         "untrusted client claims another IP",
+			remoteAddr:   "203.0.113.7:4711",
+			forwardedFor: "198.51.100.1",
+		},
+		{
+			name:           "trusted proxy forwards the locked client",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.2:4711",
+			forwardedFor:   "203.0.113.7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipPolicy := throttle.Policy{FreeAttempts: 0, BaseDelay: time.Minute, MaxDelay: time.Minute, Window: time.Hour}
+			loginThrottle := throttle.NewLoginThrottle(store.NewMemoryLoginAttemptStore(), throttle.DefaultUserPolicy, ipPolicy, throttle.DefaultWarnAfter)
+
+			_, _, err := loginThrottle.Fail("alice", "203.0.113.7", time.Now())
+			require.NoError(t, err)
+
+			application := &app.Application{
+				TokenHandler:   api.NewTokenHandler(nil, nil, nil, nil, loginThrottle, "", slog.New(slog.DiscardHandler)),
+				UserMiddleware: &middleware.UserMiddleware{},
+			}
+			application.Config.TrustedProxies = tt.trustedProxies
+
+			r, err := SetupRoutes(application)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/tokens/authentication", strings.NewReader(`{"name":"bob","password":"password123"}`))
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+	"github.com/y3933y3933/knowstro/internal/tokens"
+)
+
+// Scopes an API key can be granted. Routes that do not accept any of them are
+// closed to API keys.
+const (
+	APIKeyScopeResourcesRead  = "resources:read"
+	APIKeyScopeResourcesWrite = "resources:write"
+	APIKeyScopeCommentsWrite  = "comments:write"
+	APIKeyScopeFavoritesRead  = "favorites:read"
+	APIKeyScopeFavoritesWrite = "favorites:write"
+	APIKeyScopeProfileRead    = "profile:read"
+)
+
+var APIKeyScopes = Permissions{
+	APIKeyScopeResourcesRead,
+	APIKeyScopeResourcesWrite,
+	APIKeyScopeCommentsWrite,
+	APIKeyScopeFavoritesRead,
+	APIKeyScopeFavoritesWrite,
+	APIKeyScopeProfileRead,
+}
+
+// APIKey is a long-lived personal credential for scripts. Plaintext is only
+// set right after creation.
+type APIKey struct {
+	ID         int64       `json:"id"`
+	UserID     int         `json:"-"`
+	Name       string      `json:"name"`
+	Prefix     string      `json:"prefix"`
+	Scopes     Permissions `json:"scopes"`
+	Expiry     *time.Time  `json:"expiry"`
+	LastUsedAt *time.Time  `json:"last_used_at"`
+	CreatedAt  time.Time   `json:"created_at"`
+	Plaintext  string      `json:"key,omitzero"`
+	hash       []byte
+}
+
+// apiKeyPrefixLength is how much of a key is kept in clear so users can tell
+// their keys apart.
+const apiKeyPrefixLength = 10
+
+type PostgresAPIKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{db: db}
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(*APIKey) (*APIKey, error)
+	GetAPIKeysForUser(userID int) ([]*APIKey, error)
+	DeleteAPIKey(id int64, userID int) error
+	GetForAPIKey(plaintext string) (*User, *APIKey, error)
+}
+
+func (pg *PostgresAPIKeyStore) CreateAPIKey(key *APIKey) (*APIKey, error) {
+	plaintext, hash, err := tokens.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key.Plaintext = plaintext
+	key.Prefix = plaintext[:apiKeyPrefixLength]
+	key.hash = hash
+
+	query := `
+		INSERT INTO api_keys (user_id, name, hash, prefix, scopes, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	args := []any{key.UserID, key.Name, key.hash, key.Prefix, []string(key.Scopes), key.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = pg.db.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == UniqueViolationErr && pgErr.ConstraintName == "api_keys_user_id_name_key" {
+			return nil, ErrDuplicateAPIKey
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (pg *PostgresAPIKeyStore) GetAPIKeysForUser(userID int) ([]*APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, scopes, expiry, last_used_at, created_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes a key. Keys of other users are reported as not found.
+func (pg *PostgresAPIKeyStore) DeleteAPIKey(id int64, userID int) error {
+	query := `
+		DELETE FROM api_keys
+		WHERE id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetForAPIKey returns the owner of an unexpired key along with the key, and
+// records when the key was used.
+func (pg *PostgresAPIKeyStore) GetForAPIKey(plaintext string) (*User, *APIKey, error) {
+	query := `
+		WITH key AS (
+			UPDATE api_keys
+			SET last_used_at = $2
+			WHERE hash = $1 AND (expiry IS NULL OR expiry > $2)
+			RETURNING id, user_id, name, prefix, scopes, expiry, last_used_at, created_at
+		)
+		SELECT key.id, key.user_id, key.name, key.prefix, key.scopes, key.expiry, key.last_used_at, key.created_at,
+		       users.id, users.created_at, users.name, users.email, users.pending_email, users.password_hash,
+		       users.activated, users.totp_enabled, users.locale, users.version
+		FROM key
+		INNER JOIN users ON users.id = key.user_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	user := User{
+		Password: password{},
+	}
+
+	row := pg.db.QueryRowContext(ctx, query, tokens.HashTokenPlainText(plaintext), time.Now())
+	key, err := scanAPIKey(rowScannerFunc(func(dest ...any) error {
+		return row.Scan(append(dest,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.PendingEmail,
+			&user.Password.hash,
+			&user.Activated,
+			&user.MFAEnabled,
+			&user.Locale,
+			&user.Version,
+		)...)
+	}))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	return &user, key, nil
+}
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	var scopes pgtype.TextArray
+
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&scopes,
+		&key.Expiry,
+		&key.LastUsedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = Permissions{}
+	if err := scopes.AssignTo((*[]string)(&key.Scopes)); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
@@ -0,0 +1,293 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// MaxCommentDepth is the deepest nesting level a reply may have. Top-level
+// comments sit at depth 0.
+const MaxCommentDepth = 4
+
+type Comment struct {
+	ID         int        `json:"id"`
+	UserID     *int       `json:"user_id"`
+	Username   string     `json:"username"`
+	ResourceID int        `json:"resource_id"`
+	ParentID   *int       `json:"parent_id"`
+	Content    string     `json:"content"`
+	Depth      int        `json:"depth"`
+	Deleted    bool       `json:"deleted"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Replies    []*Comment `json:"replies"`
+}
+
+var CommentSortColumns = map[string]string{
+	"id":         "id",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+type PostgresCommentStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCommentStore(db *sql.DB) *PostgresCommentStore {
+	return &PostgresCommentStore{db: db}
+}
+
+type CommentStore interface {
+	CreateComment(*Comment) (*Comment, error)
+	GetCommentByID(id int64) (*Comment, error)
+	UpdateComment(*Comment) (*Comment, error)
+	DeleteComment(id int64) error
+	GetCommentsForResource(resourceID int64, filters Filters) ([]*Comment, Metadata, error)
+}
+
+func (pg *PostgresCommentStore) CreateComment(comment *Comment) (*Comment, error) {
+	query := `
+		INSERT INTO comments (user_id, resource_id, parent_id, content, depth)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+
+	args := []any{
+		comment.UserID,
+		comment.ResourceID,
+		comment.ParentID,
+		comment.Content,
+		comment.Depth,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := pg.db.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == ForeignKeyViolationErr {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	comment.Replies = []*Comment{}
+	return comment, nil
+}
+
+func (pg *PostgresCommentStore) GetCommentByID(id int64) (*Comment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT comments.id, comments.user_id, COALESCE(users.name, ''), comments.resource_id, comments.parent_id,
+		       comments.content, comments.depth, comments.deleted_at IS NOT NULL, comments.created_at, comments.updated_at
+		FROM comments
+		LEFT JOIN users ON users.id = comments.user_id
+		WHERE comments.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	comment, err := scanComment(pg.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return comment, nil
+}
+
+func (pg *PostgresCommentStore) UpdateComment(comment *Comment) (*Comment, error) {
+	if comment.ID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE comments
+		SET content = $1, updated_at = NOW()
+		WHERE id = $2 AND deleted_at IS NULL
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := pg.db.QueryRowContext(ctx, query, comment.Content, comment.ID).Scan(&comment.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return comment, nil
+}
+
+// DeleteComment blanks the content of the comment and marks it deleted. The
+// comment stays in its thread so replies by other users are kept.
+func (pg *PostgresCommentStore) DeleteComment(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE comments
+		SET content = '', deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetCommentsForResource returns a page of the resource's top-level comments,
+// each with its full reply tree nested beneath it. Paging and sorting apply to
+// the top-level comments only; replies are always oldest first.
+func (pg *PostgresCommentStore) GetCommentsForResource(resourceID int64, filters Filters) ([]*Comment, Metadata, error) {
+	keyset, keysetArgs := filters.keyset(CommentSortColumns, "id", 4)
+
+	query := `
+		WITH RECURSIVE roots AS (
+			SELECT id, count(*) OVER() AS total, ` + filters.cursorColumn(CommentSortColumns) + ` AS cursor_value,
+			       row_number() OVER(ORDER BY ` + filters.orderBy(CommentSortColumns, "id") + `) AS position
+			FROM comments
+			WHERE resource_id = $1 AND parent_id IS NULL
+			AND ` + keyset + `
+			ORDER BY position
+			LIMIT $2 OFFSET $3
+		), thread AS (
+			SELECT comments.*, roots.position, roots.total, roots.cursor_value
+			FROM comments
+			INNER JOIN roots ON roots.id = comments.id
+			UNION ALL
+			SELECT comments.*, thread.position, thread.total, NULL::text
+			FROM comments
+			INNER JOIN thread ON comments.parent_id = thread.id
+		)
+		SELECT thread.id, thread.user_id, COALESCE(users.name, ''), thread.resource_id, thread.parent_id,
+		       thread.content, thread.depth, thread.deleted_at IS NOT NULL, thread.created_at, thread.updated_at,
+		       thread.total, thread.cursor_value
+		FROM thread
+		LEFT JOIN users ON users.id = thread.user_id
+		ORDER BY thread.depth, thread.position, thread.created_at, thread.id
+	`
+
+	args := append([]any{resourceID, filters.limit(), filters.offset()}, keysetArgs...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, filters.cursorError(err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	comments := []*Comment{}
+
+	// Rows arrive with every top-level comment ahead of the replies, so the
+	// last top-level row seen carries the value for the next cursor.
+	var cursorValue, rowCursorValue sql.NullString
+	var lastRootID int64
+
+	for rows.Next() {
+		comment, err := scanComment(rowScannerFunc(func(dest ...any) error {
+			return rows.Scan(append(dest, &totalRecords, &rowCursorValue)...)
+		}))
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		if comment.ParentID == nil {
+			lastRootID = int64(comment.ID)
+			cursorValue = rowCursorValue
+		}
+
+		comments = append(comments, comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	roots := BuildCommentTree(comments)
+
+	return roots, filters.metadata(totalRecords, len(roots), lastRootID, cursorValue), nil
+}
+
+// BuildCommentTree nests comments under their parents. The input must be
+// ordered so that every parent precedes its replies; comments whose parent is
+// missing are treated as top-level.
+func BuildCommentTree(comments []*Comment) []*Comment {
+	byID := make(map[int]*Comment, len(comments))
+	roots := []*Comment{}
+
+	for _, comment := range comments {
+		if comment.Replies == nil {
+			comment.Replies = []*Comment{}
+		}
+		byID[comment.ID] = comment
+
+		if comment.ParentID != nil {
+			if parent, ok := byID[*comment.ParentID]; ok {
+				parent.Replies = append(parent.Replies, comment)
+				continue
+			}
+		}
+
+		roots = append(roots, comment)
+	}
+
+	return roots
+}
+
+func scanComment(row rowScanner) (*Comment, error) {
+	var comment Comment
+
+	err := row.Scan(
+		&comment.ID,
+		&comment.UserID,
+		&comment.Username,
+		&comment.ResourceID,
+		&comment.ParentID,
+		&comment.Content,
+		&comment.Depth,
+		&comment.Deleted,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	comment.Replies = []*Comment{}
+	return &comment, nil
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCommentTree(t *testing.T) {
+	parent := func(id int) *int { return &id }
+
+	comments := []*Comment{
+		{ID: 1},
+		{ID: 2, ParentID: parent(1)},
+		{ID: 3},
+		{ID: 4, ParentID: parent(2)},
+		{ID: 5, ParentID: parent(1)},
+		{ID: 6, ParentID: parent(99)},
+	}
+
+	roots := BuildCommentTree(comments)
+
+	require.Len(t, roots, 3)
+	assert.Equal(t, []int{1, 3, 6}, []int{roots[0].ID, roots[1].ID, roots[2].ID})
+
+	require.Len(t, roots[0].Replies, 2)
+	assert.Equal(t, 2, roots[0].Replies[0].ID)
+	assert.Equal(t, 5, roots[0].Replies[1].ID)
+
+	require.Len(t, roots[0].Replies[0].Replies, 1)
+	assert.Equal(t, 4, roots[0].Replies[0].Replies[0].ID)
+
+	assert.NotNil(t, roots[1].Replies)
+	assert.Empty(t, roots[1].Replies)
+}
+
+func TestDeleteCommentKeepsReplies(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	resourceType, err := NewPostgresResourceTypeStore(db).CreateResourceType(&ResourceType{Name: "book"})
+	require.NoError(t, err)
+
+	resource, err := NewPostgresResourceStore(db).CreateResource(&Resource{
+		TypeID:          resourceType.ID,
+		Title:           "The Go Programming Language",
+		Language:        "en",
+		DifficultyLevel: 3,
+	})
+	require.NoError(t, err)
+
+	newUser := func(name string) *User {
+		name = fmt.Sprintf("%s-%d", name, time.Now().UnixNano())
+		user := &User{Name: name, Email: name + "@example.com", Locale: "en"}
+		require.NoError(t, user.Password.Set("password123"))
+		require.NoError(t, insertUser(context.Background(), db, user))
+		return user
+	}
+	alice, bob := newUser("alice"), newUser("bob")
+
+	comments := NewPostgresCommentStore(db)
+
+	parent, err := comments.CreateComment(&Comment{UserID: &alice.ID, ResourceID: resource.ID, Content: "first"})
+	require.NoError(t, err)
+
+	reply, err := comments.CreateComment(&Comment{UserID: &bob.ID, ResourceID: resource.ID, ParentID: &parent.ID, Content: "reply", Depth: 1})
+	require.NoError(t, err)
+
+	require.NoError(t, comments.DeleteComment(int64(parent.ID)))
+	assert.ErrorIs(t, comments.DeleteComment(int64(parent.ID)), ErrRecordNotFound, "a comment is only deleted once")
+
+	_, err = comments.UpdateComment(&Comment{ID: parent.ID, Content: "edited"})
+	assert.ErrorIs(t, err, ErrRecordNotFound, "deleted comments cannot be edited")
+
+	roots, _, err := comments.GetCommentsForResource(int64(resource.ID), Filters{Page: 1, PageSize: 10, Sort: []string{"id"}})
+	require.NoError(t, err)
+	require.Len(t, roots, 1)
+
+	assert.True(t, roots[0].Deleted)
+	assert.Empty(t, roots[0].Content)
+	require.Len(t, roots[0].Replies, 1)
+	assert.Equal(t, reply.ID, roots[0].Replies[0].ID)
+	assert.Equal(t, "reply", roots[0].Replies[0].Content)
+	assert.False(t, roots[0].Replies[0].Deleted)
+}
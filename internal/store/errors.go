@@ -5,7 +5,11 @@ import (
 )
 
 const (
-	UniqueViolationErr = "23505"
+	UniqueViolationErr     = "23505"
+	ForeignKeyViolationErr = "23503"
+	// DataExceptionErrClass prefixes the codes of values that do not parse as
+	// their type, such as 22P02 invalid_text_representation.
+	DataExceptionErrClass = "22"
 )
 
 var (
@@ -13,4 +17,15 @@ var (
 	ErrDuplicateResourceType = errors.New("resource type already exists")
 	ErrDuplicateEmail        = errors.New("duplicate email")
 	ErrDuplicateUserName     = errors.New("duplicate username")
+	ErrInvalidResourceType   = errors.New("resource type does not exist")
+	ErrDuplicateSubject      = errors.New("subject already exists")
+	ErrInvalidSubject        = errors.New("subject does not exist")
+	ErrDuplicateTag          = errors.New("tag already exists")
+	ErrInvalidTag            = errors.New("tag does not exist")
+	ErrInvalidPermission     = errors.New("permission does not exist")
+	ErrEditConflict          = errors.New("edit conflict")
+	ErrMFAAlreadyEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled         = errors.New("two-factor authentication is not enabled")
+	ErrDuplicateAPIKey       = errors.New("an api key with this name already exists")
+	ErrDuplicateIdentity     = errors.New("identity is already linked to a user")
 )
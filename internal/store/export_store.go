@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// UserExport is the archive handed to a user asking for a copy of their data.
+type UserExport struct {
+	Profile    *User             `json:"profile"`
+	Favorites  []*FavoriteExport `json:"favorites"`
+	Comments   []*Comment        `json:"comments"`
+	Resources  []*Resource       `json:"resources"`
+	ExportedAt time.Time         `json:"exported_at"`
+}
+
+type FavoriteExport struct {
+	ResourceID  int       `json:"resource_id"`
+	Title       string    `json:"title"`
+	FavoritedAt time.Time `json:"favorited_at"`
+}
+
+type PostgresExportStore struct {
+	db *sql.DB
+}
+
+func NewPostgresExportStore(db *sql.DB) *PostgresExportStore {
+	return &PostgresExportStore{db: db}
+}
+
+type ExportStore interface {
+	ExportUser(user *User) (*UserExport, error)
+}
+
+// ExportUser collects everything stored about the user. The reads share one
+// read-only snapshot so the archive is consistent.
+func (pg *PostgresExportStore) ExportUser(user *User) (*UserExport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	export := &UserExport{
+		Profile:    user,
+		ExportedAt: time.Now(),
+	}
+
+	export.Favorites, err = exportFavorites(ctx, tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	export.Comments, err = exportComments(ctx, tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	export.Resources, err = exportResources(ctx, tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return export, tx.Commit()
+}
+
+func exportFavorites(ctx context.Context, tx *sql.Tx, userID int) ([]*FavoriteExport, error) {
+	query := `
+		SELECT resources.id, resources.title, favorites.created_at
+		FROM favorites
+		INNER JOIN resources ON resources.id = favorites.resource_id
+		WHERE favorites.user_id = $1
+		ORDER BY favorites.created_at, resources.id
+	`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	favorites := []*FavoriteExport{}
+	for rows.Next() {
+		var favorite FavoriteExport
+		err := rows.Scan(&favorite.ResourceID, &favorite.Title, &favorite.FavoritedAt)
+		if err != nil {
+			return nil, err
+		}
+		favorites = append(favorites, &favorite)
+	}
+
+	return favorites, rows.Err()
+}
+
+func exportComments(ctx context.Context, tx *sql.Tx, userID int) ([]*Comment, error) {
+	query := `
+		SELECT comments.id, comments.user_id, COALESCE(users.name, ''), comments.resource_id, comments.parent_id,
+		       comments.content, comments.depth, comments.deleted_at IS NOT NULL, comments.created_at, comments.updated_at
+		FROM comments
+		LEFT JOIN users ON users.id = comments.user_id
+		WHERE comments.user_id = $1
+		ORDER BY comments.created_at, comments.id
+	`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
+
+func exportResources(ctx context.Context, tx *sql.Tx, userID int) ([]*Resource, error) {
+	query := `
+		SELECT ` + resourceColumns + `
+		FROM resources
+		WHERE resources.created_by = $1
+		ORDER BY resources.created_at, resources.id
+	`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resources := []*Resource{}
+	for rows.Next() {
+		resource, err := scanResource(rows)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+
+	return resources, rows.Err()
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// FavoriteSortColumns extends the resource sort keys with favorited_at, the
+// time the user favorited the resource.
+var FavoriteSortColumns = map[string]string{
+	"id":               "resources.id",
+	"title":            "resources.title",
+	"created_at":       "resources.created_at",
+	"updated_at":       "resources.updated_at",
+	"difficulty_level": "resources.difficulty_level",
+	"rating":           "resources.rating",
+	"favorited_at":     "favorites.created_at",
+}
+
+type PostgresFavoriteStore struct {
+	db *sql.DB
+}
+
+func NewPostgresFavoriteStore(db *sql.DB) *PostgresFavoriteStore {
+	return &PostgresFavoriteStore{db: db}
+}
+
+type FavoriteStore interface {
+	AddFavorite(userID int, resourceID int64) error
+	RemoveFavorite(userID int, resourceID int64) error
+	GetFavoritesForUser(userID int, filters Filters) ([]*Resource, Metadata, error)
+}
+
+func (pg *PostgresFavoriteStore) AddFavorite(userID int, resourceID int64) error {
+	query := `
+		INSERT INTO favorites (user_id, resource_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := pg.db.ExecContext(ctx, query, userID, resourceID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == ForeignKeyViolationErr {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgresFavoriteStore) RemoveFavorite(userID int, resourceID int64) error {
+	query := `
+		DELETE FROM favorites
+		WHERE user_id = $1 AND resource_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, query, userID, resourceID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetFavoritesForUser returns the resources the user has favorited.
+func (pg *PostgresFavoriteStore) GetFavoritesForUser(userID int, filters Filters) ([]*Resource, Metadata, error) {
+	keyset, keysetArgs := filters.keyset(FavoriteSortColumns, "resources.id", 4)
+
+	query := `
+		SELECT ` + resourceColumns + `, count(*) OVER(), ` + filters.cursorColumn(FavoriteSortColumns) + `
+		FROM resources
+		INNER JOIN favorites ON favorites.resource_id = resources.id
+		WHERE favorites.user_id = $1
+		AND ` + keyset + `
+		ORDER BY ` + filters.orderBy(FavoriteSortColumns, "resources.id") + `
+		LIMIT $2 OFFSET $3
+	`
+
+	args := append([]any{userID, filters.limit(), filters.offset()}, keysetArgs...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, filters.cursorError(err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var cursorValue sql.NullString
+	resources := []*Resource{}
+
+	for rows.Next() {
+		resource, err := scanResource(rowScannerFunc(func(dest ...any) error {
+			return rows.Scan(append(dest, &totalRecords, &cursorValue)...)
+		}))
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		resources = append(resources, resource)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return resources, filters.metadata(totalRecords, len(resources), lastResourceID(resources), cursorValue), nil
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jackc/pgconn"
+)
+
+// Filters carries the paging and sorting options shared by every list query.
+// Sort holds keys such as "-created_at" or "name"; a leading "-" sorts
+// descending. Keys must already have been checked against the sortable
+// columns of the list being queried.
+//
+// When Cursor is set the list is read in keyset mode: rows are returned
+// after the position the cursor records and Page is ignored.
+type Filters struct {
+	Page     int
+	PageSize int
+	Sort     []string
+	Cursor   *Cursor
+}
+
+type Metadata struct {
+	CurrentPage  int    `json:"current_page,omitzero"`
+	PageSize     int    `json:"page_size,omitzero"`
+	FirstPage    int    `json:"first_page,omitzero"`
+	LastPage     int    `json:"last_page,omitzero"`
+	TotalRecords int    `json:"total_records,omitzero"`
+	NextCursor   string `json:"next_cursor,omitzero"`
+}
+
+// Cursor marks the last row a client has seen: the sort key in effect, that
+// row's value for the sort column in its Postgres text form, and its ID.
+type Cursor struct {
+	Sort  string  `json:"s"`
+	Value *string `json:"v"`
+	ID    int64   `json:"id"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+func EncodeCursor(cursor Cursor) string {
+	js, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(js, &cursor); err != nil || cursor.ID < 1 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+func (f Filters) sortKey() string {
+	if len(f.Sort) == 0 {
+		return ""
+	}
+	return f.Sort[0]
+}
+
+func sortColumn(columns map[string]string, key string) string {
+	column, ok := columns[strings.TrimPrefix(key, "-")]
+	if !ok {
+		panic("unsafe sort parameter: " + key)
+	}
+	return column
+}
+
+// orderBy turns f.Sort into an ORDER BY list using columns to map sort keys
+// to SQL expressions. idColumn is always appended so that rows with equal
+// sort values come back in a stable order.
+func (f Filters) orderBy(columns map[string]string, idColumn string) string {
+	clauses := make([]string, 0, len(f.Sort)+1)
+	for _, key := range f.Sort {
+		direction := "ASC"
+		if strings.HasPrefix(key, "-") {
+			direction = "DESC"
+		}
+
+		clauses = append(clauses, fmt.Sprintf("%s %s NULLS LAST", sortColumn(columns, key), direction))
+	}
+	clauses = append(clauses, idColumn+" ASC")
+
+	return strings.Join(clauses, ", ")
+}
+
+// keyset returns the WHERE condition that skips every row up to and
+// including the cursor, numbering its placeholders from argPos. Without a
+// cursor the condition is always true. The row order it assumes is the one
+// orderBy produces, so nulls sort after every value.
+func (f Filters) keyset(columns map[string]string, idColumn string, argPos int) (string, []any) {
+	if f.Cursor == nil {
+		return "TRUE", nil
+	}
+
+	idArg := fmt.Sprintf("$%d", argPos)
+	args := []any{f.Cursor.ID}
+
+	if f.Cursor.Sort == "" {
+		return fmt.Sprintf("%s > %s", idColumn, idArg), args
+	}
+
+	column := sortColumn(columns, f.Cursor.Sort)
+
+	if f.Cursor.Value == nil {
+		return fmt.Sprintf("(%s IS NULL AND %s > %s)", column, idColumn, idArg), args
+	}
+
+	op := ">"
+	if strings.HasPrefix(f.Cursor.Sort, "-") {
+		op = "<"
+	}
+
+	valueArg := fmt.Sprintf("$%d", argPos+1)
+	args = append(args, *f.Cursor.Value)
+
+	return fmt.Sprintf("(%[1]s %[2]s %[3]s OR (%[1]s = %[3]s AND %[4]s > %[5]s) OR %[1]s IS NULL)",
+		column, op, valueArg, idColumn, idArg), args
+}
+
+// cursorError reports err as ErrInvalidCursor when it is Postgres rejecting
+// the cursor value as data of the sort column's type. Cursors come from
+// clients, so a forged value must not look like a server error.
+func (f Filters) cursorError(err error) error {
+	var pgErr *pgconn.PgError
+	if f.Cursor != nil && errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, DataExceptionErrClass) {
+		return ErrInvalidCursor
+	}
+	return err
+}
+
+// cursorColumn selects the text form of the primary sort column so the last
+// row of a page can be turned into a cursor.
+func (f Filters) cursorColumn(columns map[string]string) string {
+	if f.sortKey() == "" {
+		return "NULL::text"
+	}
+	return sortColumn(columns, f.sortKey()) + "::text"
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	if f.Cursor != nil {
+		return 0
+	}
+	return (f.Page - 1) * f.PageSize
+}
+
+// metadata describes the page just read. totalRecords is the count(*) OVER()
+// of the query, returned the number of rows on the page, and lastID and
+// lastValue the ID and cursorColumn value of its final row. A next cursor is
+// only offered when more rows follow and the list is sorted by at most one
+// key.
+func (f Filters) metadata(totalRecords, returned int, lastID int64, lastValue sql.NullString) Metadata {
+	var metadata Metadata
+	if f.Cursor != nil {
+		metadata = Metadata{PageSize: f.PageSize}
+	} else {
+		metadata = calculateMetadata(totalRecords, f.Page, f.PageSize)
+	}
+
+	if returned > 0 && totalRecords > f.offset()+returned && len(f.Sort) <= 1 {
+		cursor := Cursor{Sort: f.sortKey(), ID: lastID}
+		if lastValue.Valid {
+			cursor.Value = &lastValue.String
+		}
+		metadata.NextCursor = EncodeCursor(cursor)
+	}
+
+	return metadata
+}
+
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
+
+// SortKeys lists the keys accepted by a sort column map, for validation.
+func SortKeys(columns map[string]string) []string {
+	keys := make([]string, 0, len(columns))
+	for key := range columns {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgconn"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFiltersOrderBy(t *testing.T) {
+	columns := map[string]string{
+		"name":       "tags.name",
+		"created_at": "tags.created_at",
+	}
+
+	tests := []struct {
+		name string
+		sort []string
+		want string
+	}{
+		{
+			name: "no sort falls back to id",
+			want: "tags.id ASC",
+		},
+		{
+			name: "mixed directions",
+			sort: []string{"-created_at", "name"},
+			want: "tags.created_at DESC NULLS LAST, tags.name ASC NULLS LAST, tags.id ASC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{Page: 1, PageSize: 20, Sort: tt.sort}
+			assert.Equal(t, tt.want, f.orderBy(columns, "tags.id"))
+		})
+	}
+
+	assert.Panics(t, func() {
+		Filters{Sort: []string{"password_hash"}}.orderBy(columns, "tags.id")
+	})
+}
+
+func TestCalculateMetadata(t *testing.T) {
+	assert.Equal(t, Metadata{}, calculateMetadata(0, 1, 20))
+	assert.Equal(t, Metadata{
+		CurrentPage:  2,
+		PageSize:     20,
+		FirstPage:    1,
+		LastPage:     3,
+		TotalRecords: 41,
+	}, calculateMetadata(41, 2, 20))
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	value := "2025-01-02 03:04:05.123456+00"
+	encoded := EncodeCursor(Cursor{Sort: "-created_at", Value: &value, ID: 42})
+
+	decoded, err := DecodeCursor(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, "-created_at", decoded.Sort)
+	assert.Equal(t, value, *decoded.Value)
+	assert.Equal(t, int64(42), decoded.ID)
+
+	_, err = DecodeCursor("not a cursor")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestFiltersKeyset(t *testing.T) {
+	columns := map[string]string{"rating": "resources.rating"}
+	value := "4.5"
+
+	tests := []struct {
+		name     string
+		cursor   *Cursor
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:    "no cursor",
+			wantSQL: "TRUE",
+		},
+		{
+			name:     "id only",
+			cursor:   &Cursor{ID: 7},
+			wantSQL:  "resources.id > $3",
+			wantArgs: []any{int64(7)},
+		},
+		{
+			name:     "descending value",
+			cursor:   &Cursor{Sort: "-rating", Value: &value, ID: 7},
+			wantSQL:  "(resources.rating < $4 OR (resources.rating = $4 AND resources.id > $3) OR resources.rating IS NULL)",
+			wantArgs: []any{int64(7), "4.5"},
+		},
+		{
+			name:     "null value",
+			cursor:   &Cursor{Sort: "rating", ID: 7},
+			wantSQL:  "(resources.rating IS NULL AND resources.id > $3)",
+			wantArgs: []any{int64(7)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{PageSize: 20, Cursor: tt.cursor}
+			gotSQL, gotArgs := f.keyset(columns, "resources.id", 3)
+			assert.Equal(t, tt.wantSQL, gotSQL)
+			assert.Equal(t, tt.wantArgs, gotArgs)
+		})
+	}
+}
+
+func TestFiltersMetadataNextCursor(t *testing.T) {
+	value := "b"
+	f := Filters{Page: 1, PageSize: 2, Sort: []string{"name"}}
+
+	metadata := f.metadata(5, 2, 9, sql.NullString{String: value, Valid: true})
+	require.NotEmpty(t, metadata.NextCursor)
+	assert.Equal(t, 3, metadata.LastPage)
+
+	cursor, err := DecodeCursor(metadata.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, Cursor{Sort: "name", Value: &value, ID: 9}, *cursor)
+
+	last := f.metadata(2, 2, 9, sql.NullString{String: value, Valid: true})
+	assert.Empty(t, last.NextCursor)
+
+	f.Cursor = cursor
+	keyset := f.metadata(1, 1, 10, sql.NullString{})
+	assert.Equal(t, Metadata{PageSize: 2}, keyset)
+}
+
+func TestFiltersCursorError(t *testing.T) {
+	value := "abc"
+	forged := Filters{Sort: []string{"rating"}, Cursor: &Cursor{Sort: "rating", Value: &value, ID: 1}}
+	badValue := &pgconn.PgError{Code: "22P02"}
+	other := errors.New("connection reset")
+
+	assert.ErrorIs(t, forged.cursorError(badValue), ErrInvalidCursor)
+	assert.Equal(t, other, forged.cursorError(other))
+	assert.Equal(t, badValue, Filters{}.cursorError(badValue), "without a cursor the error is not the client's")
+}
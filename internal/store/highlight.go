@@ -0,0 +1,112 @@
+package store
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+const snippetRadius = 60
+
+// headlineOptions makes ts_headline return one short fragment with matches
+// wrapped the same way Highlight wraps them.
+const headlineOptions = "StartSel=<b>, StopSel=</b>, MinWords=10, MaxWords=25, MaxFragments=1"
+
+// headline returns SQL that highlights column against search.query with
+// ts_headline, so a match is marked exactly when the stemmed tsquery matched
+// it ("running" marks "runs"). The column is HTML-escaped first; the default
+// parser reads the escapes as entities, which leaves word matching alone.
+func headline(column string) string {
+	escaped := `replace(replace(replace(` + column + `, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')`
+	return `ts_headline('english', ` + escaped + `, search.query, '` + headlineOptions + `')`
+}
+
+// searchTerms splits a search query into the lowercased terms worth
+// highlighting. Web search operators (quotes, a leading "-" and "or") are
+// dropped.
+func searchTerms(query string) [][]rune {
+	var terms [][]rune
+	for _, field := range strings.FieldsFunc(query, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"'
+	}) {
+		if strings.HasPrefix(field, "-") || strings.EqualFold(field, "or") {
+			continue
+		}
+		field = strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		if field == "" {
+			continue
+		}
+		terms = append(terms, []rune(strings.ToLower(field)))
+	}
+	return terms
+}
+
+// Highlight returns a snippet of text centred on the first match of any
+// term in query, with every match wrapped in <b></b>. Matching is a
+// case-insensitive substring search, which is how CJK phrases match and
+// which ts_headline cannot mark in unsegmented CJK text. The rest of the
+// snippet is HTML-escaped. If nothing matches, the start of text is returned.
+func Highlight(text, query string) string {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	terms := searchTerms(query)
+
+	matchAt := func(i int) int {
+		longest := 0
+		for _, term := range terms {
+			if len(term) > longest && i+len(term) <= len(lower) && string(lower[i:i+len(term)]) == string(term) {
+				longest = len(term)
+			}
+		}
+		return longest
+	}
+
+	first := -1
+	for i := range lower {
+		if matchAt(i) > 0 {
+			first = i
+			break
+		}
+	}
+
+	start, end := 0, min(len(runes), 2*snippetRadius)
+	if first >= 0 {
+		start = max(0, first-snippetRadius)
+		end = min(len(runes), first+snippetRadius)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+
+	plainFrom := start
+	for i := start; i < end; {
+		n := matchAt(i)
+		if n == 0 {
+			i++
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[plainFrom:i])))
+		b.WriteString("<b>")
+		b.WriteString(html.EscapeString(string(runes[i:min(i+n, len(runes))])))
+		b.WriteString("</b>")
+		i += n
+		plainFrom = i
+	}
+	if plainFrom < end {
+		b.WriteString(html.EscapeString(string(runes[plainFrom:end])))
+	}
+
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		query string
+		want  string
+	}{
+		{
+			name:  "english term is case insensitive",
+			text:  "Learning Go the hard way",
+			query: "go",
+			want:  "Learning <b>Go</b> the hard way",
+		},
+		{
+			name:  "cjk substring",
+			text:  "Go 語言學習筆記",
+			query: "學習",
+			want:  "Go 語言<b>學習</b>筆記",
+		},
+		{
+			name:  "excluded and quoted terms",
+			text:  "concurrency in go and rust",
+			query: `"concurrency" -rust or go`,
+			want:  "<b>concurrency</b> in <b>go</b> and rust",
+		},
+		{
+			name:  "html is escaped",
+			text:  "<script> tags & go",
+			query: "go",
+			want:  "&lt;script&gt; tags &amp; <b>go</b>",
+		},
+		{
+			name:  "no match returns the start",
+			text:  "nothing to see here",
+			query: "python",
+			want:  "nothing to see here",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Highlight(tt.text, tt.query))
+		})
+	}
+}
+
+func TestHighlightTrimsAroundMatch(t *testing.T) {
+	text := strings.Repeat("a", 200) + "needle" + strings.Repeat("b", 200)
+
+	got := Highlight(text, "needle")
+
+	assert.True(t, strings.HasPrefix(got, "…"))
+	assert.True(t, strings.HasSuffix(got, "…"))
+	assert.Contains(t, got, "<b>needle</b>")
+}
@@ -0,0 +1,244 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/y3933y3933/knowstro/internal/tokens"
+)
+
+// UserIdentity links a user to their account at an external identity
+// provider.
+type UserIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	UserID    int       `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCLoginState is what must be remembered between sending a user to an
+// identity provider and handling the callback.
+type OIDCLoginState struct {
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	Expiry       time.Time
+}
+
+type PostgresIdentityStore struct {
+	db *sql.DB
+}
+
+func NewPostgresIdentityStore(db *sql.DB) *PostgresIdentityStore {
+	return &PostgresIdentityStore{db: db}
+}
+
+type IdentityStore interface {
+	GetUserForIdentity(provider, subject string) (*User, error)
+	LinkIdentity(*UserIdentity) error
+	CreateUserWithIdentity(*User, *UserIdentity) error
+	ClaimUserWithIdentity(*User, *UserIdentity) error
+	CreateLoginState(state string, loginState *OIDCLoginState) error
+	ConsumeLoginState(state string) (*OIDCLoginState, error)
+}
+
+func (pg *PostgresIdentityStore) GetUserForIdentity(provider, subject string) (*User, error) {
+	query := `
+		SELECT users.id, users.name, users.email, users.pending_email, users.password_hash, users.activated,
+		       users.totp_enabled, users.locale, users.created_at, users.version
+		FROM users
+		INNER JOIN user_identities ON user_identities.user_id = users.id
+		WHERE user_identities.provider = $1 AND user_identities.subject = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	user := &User{
+		Password: password{},
+	}
+
+	err := pg.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.PendingEmail,
+		&user.Password.hash,
+		&user.Activated,
+		&user.MFAEnabled,
+		&user.Locale,
+		&user.CreatedAt,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (pg *PostgresIdentityStore) LinkIdentity(identity *UserIdentity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertIdentity(ctx, pg.db, identity)
+}
+
+// CreateUserWithIdentity creates a user who signed up through an identity
+// provider, so a user never exists without the identity they signed up with.
+func (pg *PostgresIdentityStore) CreateUserWithIdentity(user *User, identity *UserIdentity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertUser(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+	err = insertIdentity(ctx, tx, identity)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ClaimUserWithIdentity hands an unactivated user over to the owner of a
+// verified identity with the same email address. Whoever registered the
+// account never proved they own the address, so the new password hash of user
+// replaces theirs, a pending email change is dropped and every token of the
+// account is revoked before the identity is linked.
+func (pg *PostgresIdentityStore) ClaimUserWithIdentity(user *User, identity *UserIdentity) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1, pending_email = NULL, activated = true, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND version = $3 AND activated = false
+		RETURNING version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, user.Password.hash, user.ID, user.Version).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = $1`, user.ID)
+	if err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+	err = insertIdentity(ctx, tx, identity)
+	if err != nil {
+		return err
+	}
+
+	user.Activated = true
+	user.PendingEmail = nil
+	return tx.Commit()
+}
+
+func insertIdentity(ctx context.Context, q queryer, identity *UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (provider, subject, user_id, email)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		RETURNING created_at
+	`
+
+	args := []any{identity.Provider, identity.Subject, identity.UserID, identity.Email}
+
+	err := q.QueryRowContext(ctx, query, args...).Scan(&identity.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == UniqueViolationErr {
+			return ErrDuplicateIdentity
+		}
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgresIdentityStore) CreateLoginState(state string, loginState *OIDCLoginState) error {
+	query := `
+		INSERT INTO oidc_login_states (hash, provider, code_verifier, nonce, expiry)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	args := []any{
+		tokens.HashTokenPlainText(state),
+		loginState.Provider,
+		loginState.CodeVerifier,
+		loginState.Nonce,
+		loginState.Expiry,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := pg.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// ConsumeLoginState returns the unexpired login state for a state parameter
+// and deletes it, so each can only complete one login. Expired states are
+// cleaned up along the way.
+func (pg *PostgresIdentityStore) ConsumeLoginState(state string) (*OIDCLoginState, error) {
+	query := `
+		WITH expired AS (
+			DELETE FROM oidc_login_states WHERE expiry <= $2
+		)
+		DELETE FROM oidc_login_states
+		WHERE hash = $1 AND expiry > $2
+		RETURNING provider, code_verifier, nonce, expiry
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var loginState OIDCLoginState
+	err := pg.db.QueryRowContext(ctx, query, tokens.HashTokenPlainText(state), time.Now()).Scan(
+		&loginState.Provider,
+		&loginState.CodeVerifier,
+		&loginState.Nonce,
+		&loginState.Expiry,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &loginState, nil
+}
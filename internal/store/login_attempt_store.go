@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// LoginAttempt tracks the recent failed logins for one key, such as a
+// username or a client IP.
+type LoginAttempt struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// LoginAttemptStore records failed logins. Failures older than the window
+// passed to RecordFailedLogin no longer count, so the counter starts over.
+type LoginAttemptStore interface {
+	GetLoginAttempt(key string) (*LoginAttempt, error)
+	RecordFailedLogin(key string, now time.Time, window time.Duration) (*LoginAttempt, error)
+	LockLogin(key string, until time.Time) error
+	ResetLoginAttempts(key string) error
+}
+
+type PostgresLoginAttemptStore struct {
+	db *sql.DB
+}
+
+func NewPostgresLoginAttemptStore(db *sql.DB) *PostgresLoginAttemptStore {
+	return &PostgresLoginAttemptStore{db: db}
+}
+
+// GetLoginAttempt returns a zero attempt for keys without any failures.
+func (pg *PostgresLoginAttemptStore) GetLoginAttempt(key string) (*LoginAttempt, error) {
+	query := `
+		SELECT failures, last_failure_at, locked_until
+		FROM login_attempts
+		WHERE key = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	attempt := &LoginAttempt{Key: key}
+	var lockedUntil sql.NullTime
+
+	err := pg.db.QueryRowContext(ctx, query, key).Scan(&attempt.Failures, &attempt.LastFailureAt, &lockedUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return attempt, nil
+		default:
+			return nil, err
+		}
+	}
+
+	attempt.LockedUntil = lockedUntil.Time
+	return attempt, nil
+}
+
+func (pg *PostgresLoginAttemptStore) RecordFailedLogin(key string, now time.Time, window time.Duration) (*LoginAttempt, error) {
+	query := `
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE
+		SET failures = CASE
+				WHEN login_attempts.last_failure_at < $3 THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures, last_failure_at, locked_until
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	attempt := &LoginAttempt{Key: key}
+	var lockedUntil sql.NullTime
+
+	err := pg.db.QueryRowContext(ctx, query, key, now, now.Add(-window)).Scan(&attempt.Failures, &attempt.LastFailureAt, &lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	attempt.LockedUntil = lockedUntil.Time
+	return attempt, nil
+}
+
+func (pg *PostgresLoginAttemptStore) LockLogin(key string, until time.Time) error {
+	query := `
+		UPDATE login_attempts
+		SET locked_until = $2
+		WHERE key = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := pg.db.ExecContext(ctx, query, key, until)
+	return err
+}
+
+func (pg *PostgresLoginAttemptStore) ResetLoginAttempts(key string) error {
+	query := `
+		DELETE FROM login_attempts
+		WHERE key = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := pg.db.ExecContext(ctx, query, key)
+	return err
+}
+
+// MemoryLoginAttemptStore keeps login attempts in process memory. It is only
+// suitable when a single instance serves every login.
+type MemoryLoginAttemptStore struct {
+	mu        sync.Mutex
+	attempts  map[string]LoginAttempt
+	lastSweep time.Time
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: map[string]LoginAttempt{}}
+}
+
+func (m *MemoryLoginAttemptStore) GetLoginAttempt(key string) (*LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt, ok := m.attempts[key]
+	if !ok {
+		attempt.Key = key
+	}
+	return &attempt, nil
+}
+
+func (m *MemoryLoginAttemptStore) RecordFailedLogin(key string, now time.Time, window time.Duration) (*LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now, window)
+
+	attempt, ok := m.attempts[key]
+	if !ok || attempt.LastFailureAt.Before(now.Add(-window)) {
+		attempt.Key = key
+		attempt.Failures = 0
+	}
+
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	m.attempts[key] = attempt
+
+	return &attempt, nil
+}
+
+func (m *MemoryLoginAttemptStore) LockLogin(key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if attempt, ok := m.attempts[key]; ok {
+		attempt.LockedUntil = until
+		m.attempts[key] = attempt
+	}
+	return nil
+}
+
+func (m *MemoryLoginAttemptStore) ResetLoginAttempts(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
+
+// sweep drops attempts that have neither a recent failure nor an active lock,
+// at most once per window. The caller must hold m.mu.
+func (m *MemoryLoginAttemptStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(m.lastSweep) < window {
+		return
+	}
+	m.lastSweep = now
+
+	for key, attempt := range m.attempts {
+		if attempt.LastFailureAt.Before(now.Add(-window)) && attempt.LockedUntil.Before(now) {
+			delete(m.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+// TOTP is the authenticator enrollment of a user. Secret is nil until the
+// user starts enrolling, and Enabled stays false until a code is confirmed.
+type TOTP struct {
+	Secret   []byte
+	Enabled  bool
+	LastStep int64
+}
+
+type PostgresMFAStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMFAStore(db *sql.DB) *PostgresMFAStore {
+	return &PostgresMFAStore{db: db}
+}
+
+type MFAStore interface {
+	GetTOTP(userID int) (*TOTP, error)
+	SetTOTPSecret(userID int, secret []byte) error
+	EnableTOTP(userID int, recoveryCodeHashes [][]byte) error
+	DisableTOTP(userID int) error
+	UseTOTPStep(userID int, step int64) (bool, error)
+	UseRecoveryCode(userID int, hash []byte) (bool, error)
+}
+
+func (pg *PostgresMFAStore) GetTOTP(userID int) (*TOTP, error) {
+	query := `
+		SELECT totp_secret, totp_enabled, COALESCE(totp_last_step, 0)
+		FROM users
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var totp TOTP
+	err := pg.db.QueryRowContext(ctx, query, userID).Scan(&totp.Secret, &totp.Enabled, &totp.LastStep)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &totp, nil
+}
+
+// SetTOTPSecret starts a new enrollment. It leaves an enabled authenticator
+// alone so an existing second factor cannot be swapped out this way.
+func (pg *PostgresMFAStore) SetTOTPSecret(userID int, secret []byte) error {
+	query := `
+		UPDATE users
+		SET totp_secret = $2, totp_last_step = NULL
+		WHERE id = $1 AND NOT totp_enabled
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+// EnableTOTP turns the second factor on and replaces the user's recovery
+// codes in one transaction.
+func (pg *PostgresMFAStore) EnableTOTP(userID int, recoveryCodeHashes [][]byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE users
+		SET totp_enabled = TRUE, version = version + 1
+		WHERE id = $1 AND totp_secret IS NOT NULL AND NOT totp_enabled
+	`, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	var hashes pgtype.ByteaArray
+	err = hashes.Set(recoveryCodeHashes)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO recovery_codes (hash, user_id)
+		SELECT unnest($1::bytea[]), $2
+	`, hashes, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP turns the second factor off, forgetting the authenticator and
+// the recovery codes in one transaction.
+func (pg *PostgresMFAStore) DisableTOTP(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE users
+		SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = NULL, version = version + 1
+		WHERE id = $1 AND totp_enabled
+	`, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrMFANotEnabled
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that the code of a time step has been used. It reports
+// false if that step or a later one was already used, which stops a code from
+// being replayed.
+func (pg *PostgresMFAStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	query := `
+		UPDATE users
+		SET totp_last_step = $2
+		WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode consumes a recovery code, reporting whether it was valid.
+func (pg *PostgresMFAStore) UseRecoveryCode(userID int, hash []byte) (bool, error) {
+	query := `
+		DELETE FROM recovery_codes
+		WHERE user_id = $1 AND hash = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
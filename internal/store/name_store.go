@@ -0,0 +1,282 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// NamedRecord is what subjects and tags are: a unique name that resources
+// are attached to through a join table.
+type NamedRecord struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+var NameSortColumns = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"created_at": "created_at",
+}
+
+// nameTable says where one kind of named record is kept and which errors
+// report a duplicate name or an unknown ID.
+type nameTable struct {
+	table        string
+	joinTable    string
+	joinColumn   string
+	errDuplicate error
+	errInvalid   error
+}
+
+// NameStore is the part of SubjectStore and TagStore that manages the
+// records themselves.
+type NameStore interface {
+	Create(name string) (*NamedRecord, error)
+	GetByID(id int64) (*NamedRecord, error)
+	Update(*NamedRecord) (*NamedRecord, error)
+	Delete(id int64) error
+	GetAll(filters Filters) ([]*NamedRecord, Metadata, error)
+}
+
+// nameStore implements the queries shared by PostgresSubjectStore and
+// PostgresTagStore.
+type nameStore struct {
+	db *sql.DB
+	nameTable
+}
+
+func (s *nameStore) Create(name string) (*NamedRecord, error) {
+	query := `
+		INSERT INTO ` + s.table + ` (name)
+		VALUES ($1)
+		RETURNING id, name
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var record NamedRecord
+	err := s.db.QueryRowContext(ctx, query, name).Scan(&record.ID, &record.Name)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == UniqueViolationErr {
+			return nil, s.errDuplicate
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (s *nameStore) GetByID(id int64) (*NamedRecord, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, name
+		FROM ` + s.table + `
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var record NamedRecord
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&record.ID, &record.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &record, nil
+}
+
+func (s *nameStore) Update(record *NamedRecord) (*NamedRecord, error) {
+	if record.ID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE ` + s.table + `
+		SET name = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING id, name
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, record.Name, record.ID).Scan(&record.ID, &record.Name)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		case errors.As(err, &pgErr) && pgErr.Code == UniqueViolationErr:
+			return nil, s.errDuplicate
+		default:
+			return nil, err
+		}
+	}
+
+	return record, nil
+}
+
+func (s *nameStore) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM ` + s.table + `
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *nameStore) GetAll(filters Filters) ([]*NamedRecord, Metadata, error) {
+	keyset, keysetArgs := filters.keyset(NameSortColumns, "id", 3)
+
+	query := `
+		SELECT count(*) OVER(), ` + filters.cursorColumn(NameSortColumns) + `, id, name
+		FROM ` + s.table + `
+		WHERE ` + keyset + `
+		ORDER BY ` + filters.orderBy(NameSortColumns, "id") + `
+		LIMIT $1 OFFSET $2
+	`
+
+	args := append([]any{filters.limit(), filters.offset()}, keysetArgs...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, filters.cursorError(err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var cursorValue sql.NullString
+	records := []*NamedRecord{}
+	var lastID int64
+
+	for rows.Next() {
+		var record NamedRecord
+		err := rows.Scan(&totalRecords, &cursorValue, &record.ID, &record.Name)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		records = append(records, &record)
+		lastID = int64(record.ID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return records, filters.metadata(totalRecords, len(records), lastID, cursorValue), nil
+}
+
+// setForResource replaces every record attached to the resource with ids.
+func (s *nameStore) setForResource(resourceID int64, ids []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM `+s.joinTable+` WHERE resource_id = $1`, resourceID)
+	if err != nil {
+		return err
+	}
+
+	err = s.attach(ctx, tx, resourceID, ids)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *nameStore) addToResource(resourceID int64, ids []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return s.attach(ctx, s.db, resourceID, ids)
+}
+
+func (s *nameStore) removeFromResource(resourceID, id int64) error {
+	query := `
+		DELETE FROM ` + s.joinTable + `
+		WHERE resource_id = $1 AND ` + s.joinColumn + ` = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, resourceID, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *nameStore) attach(ctx context.Context, db execer, resourceID int64, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO ` + s.joinTable + ` (resource_id, ` + s.joinColumn + `)
+		SELECT $1::bigint, unnest($2::bigint[])
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err := db.ExecContext(ctx, query, resourceID, ids)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == ForeignKeyViolationErr {
+			return s.errInvalid
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSending = "sending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusDead    = "dead"
+)
+
+// OutboxEmail is an email waiting to be sent, or the record of one that was.
+// Data holds the template data and is kept out of API responses because it
+// carries tokens.
+type OutboxEmail struct {
+	ID            int64           `json:"id"`
+	Recipient     string          `json:"recipient"`
+	Locale        string          `json:"locale"`
+	Template      string          `json:"template"`
+	Data          json.RawMessage `json:"-"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     *string         `json:"last_error"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+	SentAt        *time.Time      `json:"sent_at"`
+}
+
+// NewOutboxEmail prepares an email for the outbox. data must marshal to a
+// JSON object whose fields the template refers to, and locale picks the
+// language of the template.
+func NewOutboxEmail(recipient, locale, template string, data any) (*OutboxEmail, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OutboxEmail{
+		Recipient: recipient,
+		Locale:    locale,
+		Template:  template,
+		Data:      raw,
+	}, nil
+}
+
+var OutboxSortColumns = map[string]string{
+	"id":              "id",
+	"created_at":      "created_at",
+	"next_attempt_at": "next_attempt_at",
+}
+
+type PostgresOutboxStore struct {
+	db *sql.DB
+}
+
+func NewPostgresOutboxStore(db *sql.DB) *PostgresOutboxStore {
+	return &PostgresOutboxStore{db: db}
+}
+
+type OutboxStore interface {
+	Enqueue(*OutboxEmail) error
+	ClaimEmails(limit int, lease time.Duration) ([]*OutboxEmail, error)
+	MarkSent(id int64) error
+	MarkFailed(id int64, sendErr string, nextAttemptAt time.Time) error
+	MarkDead(id int64, sendErr string) error
+	GetEmail(id int64) (*OutboxEmail, error)
+	GetEmails(status string, filters Filters) ([]*OutboxEmail, Metadata, error)
+	Requeue(id int64) (*OutboxEmail, error)
+	PurgeDeadData(before time.Time) (int64, error)
+}
+
+func (pg *PostgresOutboxStore) Enqueue(email *OutboxEmail) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return enqueueEmail(ctx, pg.db, email)
+}
+
+// enqueueEmail lets other stores queue an email inside their own transaction,
+// so it is only sent if the change it announces is committed.
+func enqueueEmail(ctx context.Context, q queryer, email *OutboxEmail) error {
+	query := `
+		INSERT INTO email_outbox (recipient, locale, template, data)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, status, next_attempt_at, created_at
+	`
+
+	return q.QueryRowContext(ctx, query, email.Recipient, email.Locale, email.Template, []byte(email.Data)).Scan(
+		&email.ID,
+		&email.Status,
+		&email.NextAttemptAt,
+		&email.CreatedAt,
+	)
+}
+
+// ClaimEmails hands out due emails to one worker. Claimed emails are leased
+// rather than locked, so an email claimed by a worker that dies is retried
+// once the lease runs out.
+func (pg *PostgresOutboxStore) ClaimEmails(limit int, lease time.Duration) ([]*OutboxEmail, error) {
+	query := `
+		UPDATE email_outbox
+		SET status = 'sending', attempts = attempts + 1, locked_until = $2
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE (status = 'pending' AND next_attempt_at <= $1)
+			   OR (status = 'sending' AND locked_until <= $1)
+			ORDER BY next_attempt_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + outboxColumns
+
+	now := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []*OutboxEmail{}
+	for rows.Next() {
+		email, err := scanOutboxEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+
+	return emails, rows.Err()
+}
+
+// MarkSent records a delivered email and drops its template data, which may
+// hold tokens that must not outlive the email.
+func (pg *PostgresOutboxStore) MarkSent(id int64) error {
+	return pg.update(`
+		UPDATE email_outbox
+		SET status = 'sent', sent_at = NOW(), locked_until = NULL, last_error = NULL, data = '{}'
+		WHERE id = $1
+	`, id)
+}
+
+// MarkFailed puts an email back in the queue to be retried at nextAttemptAt.
+func (pg *PostgresOutboxStore) MarkFailed(id int64, sendErr string, nextAttemptAt time.Time) error {
+	return pg.update(`
+		UPDATE email_outbox
+		SET status = 'pending', last_error = $2, next_attempt_at = $3, locked_until = NULL
+		WHERE id = $1
+	`, id, sendErr, nextAttemptAt)
+}
+
+// MarkDead gives up on an email until an admin requeues it.
+func (pg *PostgresOutboxStore) MarkDead(id int64, sendErr string) error {
+	return pg.update(`
+		UPDATE email_outbox
+		SET status = 'dead', last_error = $2, locked_until = NULL
+		WHERE id = $1
+	`, id, sendErr)
+}
+
+func (pg *PostgresOutboxStore) update(query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+const outboxColumns = `id, recipient, locale, template, data, status, attempts, last_error, next_attempt_at, created_at, sent_at`
+
+func (pg *PostgresOutboxStore) GetEmail(id int64) (*OutboxEmail, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + outboxColumns + `
+		FROM email_outbox
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	email, err := scanOutboxEmail(pg.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return email, nil
+}
+
+// GetEmails lists the outbox, optionally only emails with the given status.
+func (pg *PostgresOutboxStore) GetEmails(status string, filters Filters) ([]*OutboxEmail, Metadata, error) {
+	keyset, keysetArgs := filters.keyset(OutboxSortColumns, "id", 4)
+
+	query := `
+		SELECT ` + outboxColumns + `, count(*) OVER(), ` + filters.cursorColumn(OutboxSortColumns) + `
+		FROM email_outbox
+		WHERE (status = $1 OR $1 = '')
+		AND ` + keyset + `
+		ORDER BY ` + filters.orderBy(OutboxSortColumns, "id") + `
+		LIMIT $2 OFFSET $3
+	`
+
+	args := append([]any{status, filters.limit(), filters.offset()}, keysetArgs...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, filters.cursorError(err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var cursorValue sql.NullString
+	emails := []*OutboxEmail{}
+
+	for rows.Next() {
+		email, err := scanOutboxEmail(rowScannerFunc(func(dest ...any) error {
+			return rows.Scan(append(dest, &totalRecords, &cursorValue)...)
+		}))
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		emails = append(emails, email)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var lastID int64
+	if len(emails) > 0 {
+		lastID = emails[len(emails)-1].ID
+	}
+
+	return emails, filters.metadata(totalRecords, len(emails), lastID, cursorValue), nil
+}
+
+// Requeue gives a dead email a fresh set of attempts, starting now. Emails
+// whose data has been purged cannot be sent again.
+func (pg *PostgresOutboxStore) Requeue(id int64) (*OutboxEmail, error) {
+	query := `
+		UPDATE email_outbox
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW(), locked_until = NULL
+		WHERE id = $1 AND status = 'dead' AND data <> '{}'
+		RETURNING ` + outboxColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	email, err := scanOutboxEmail(pg.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return email, nil
+}
+
+// PurgeDeadData drops the template data, which may hold tokens, of dead
+// emails created before cutoff. It returns how many emails were purged.
+func (pg *PostgresOutboxStore) PurgeDeadData(before time.Time) (int64, error) {
+	query := `
+		UPDATE email_outbox
+		SET data = '{}'
+		WHERE status = 'dead' AND created_at < $1 AND data <> '{}'
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func scanOutboxEmail(row rowScanner) (*OutboxEmail, error) {
+	var email OutboxEmail
+	var data []byte
+
+	err := row.Scan(
+		&email.ID,
+		&email.Recipient,
+		&email.Locale,
+		&email.Template,
+		&data,
+		&email.Status,
+		&email.Attempts,
+		&email.LastError,
+		&email.NextAttemptAt,
+		&email.CreatedAt,
+		&email.SentAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	email.Data = data
+	return &email, nil
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+const (
+	PermissionTypesWrite        = "types:write"
+	PermissionSubjectsWrite     = "subjects:write"
+	PermissionTagsWrite         = "tags:write"
+	PermissionResourcesModerate = "resources:moderate"
+	PermissionTypesReset        = "types:reset"
+	PermissionPermissionsWrite  = "permissions:write"
+	PermissionEmailsManage      = "emails:manage"
+)
+
+// AdminPermissions may only be exercised by users with a second factor.
+var AdminPermissions = Permissions{PermissionTypesReset, PermissionPermissionsWrite, PermissionEmailsManage}
+
+type Permissions []string
+
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+type PostgresPermissionStore struct {
+	db *sql.DB
+}
+
+func NewPostgresPermissionStore(db *sql.DB) *PostgresPermissionStore {
+	return &PostgresPermissionStore{db: db}
+}
+
+type PermissionStore interface {
+	GetAllForUser(userID int) (Permissions, error)
+	AddForUser(userID int, codes ...string) error
+	RemoveForUser(userID int, codes ...string) error
+}
+
+func (pg *PostgresPermissionStore) GetAllForUser(userID int) (Permissions, error) {
+	query := `
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+		WHERE users_permissions.user_id = $1
+		ORDER BY permissions.code
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := Permissions{}
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// AddForUser grants codes to the user. Codes the user already holds are left
+// alone; an unknown code fails the whole call with ErrInvalidPermission.
+func (pg *PostgresPermissionStore) AddForUser(userID int, codes ...string) error {
+	query := `
+		WITH known AS (
+			SELECT id FROM permissions WHERE code = ANY($2)
+		), inserted AS (
+			INSERT INTO users_permissions (user_id, permission_id)
+			SELECT $1::bigint, known.id FROM known
+			WHERE (SELECT count(*) FROM known) = cardinality($2)
+			ON CONFLICT DO NOTHING
+		)
+		SELECT count(*) FROM known
+	`
+
+	codes = uniqueCodes(codes)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var known int
+	err := pg.db.QueryRowContext(ctx, query, userID, codes).Scan(&known)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == ForeignKeyViolationErr {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	if known != len(codes) {
+		return ErrInvalidPermission
+	}
+	return nil
+}
+
+func (pg *PostgresPermissionStore) RemoveForUser(userID int, codes ...string) error {
+	query := `
+		DELETE FROM users_permissions
+		WHERE user_id = $1
+		AND permission_id IN (SELECT id FROM permissions WHERE code = ANY($2))
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := pg.db.ExecContext(ctx, query, userID, uniqueCodes(codes))
+	return err
+}
+
+func uniqueCodes(codes []string) []string {
+	codes = slices.Clone(codes)
+	slices.Sort(codes)
+	return slices.Compact(codes)
+}
@@ -0,0 +1,448 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+)
+
+type Resource struct {
+	ID              int       `json:"id"`
+	TypeID          int       `json:"type_id"`
+	Title           string    `json:"title"`
+	Description     string    `json:"description"`
+	URL             string    `json:"url"`
+	Author          string    `json:"author"`
+	Publisher       string    `json:"publisher"`
+	Language        string    `json:"language"`
+	DifficultyLevel int       `json:"difficulty_level"`
+	Rating          *float64  `json:"rating"`
+	Subjects        []string  `json:"subjects"`
+	Tags            []string  `json:"tags"`
+	IsFavorited     bool      `json:"is_favorited"`
+	FavoriteCount   int       `json:"favorite_count"`
+	CreatedBy       *int      `json:"created_by"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// resourceColumns is the select list shared by every resource read. Subject and
+// tag names are aggregated from the join tables so callers get them in one row.
+// Queries using it must bind the viewing user's ID as $1; anonymous callers pass
+// 0, which never matches a favorite.
+const resourceColumns = `
+	resources.id, resources.type_id, resources.title, COALESCE(resources.description, ''),
+	COALESCE(resources.url, ''), COALESCE(resources.author, ''), COALESCE(resources.publisher, ''),
+	resources.language, resources.difficulty_level, resources.rating,
+	ARRAY(
+		SELECT subjects.name FROM resource_subjects
+		INNER JOIN subjects ON subjects.id = resource_subjects.subject_id
+		WHERE resource_subjects.resource_id = resources.id
+		ORDER BY subjects.name
+	),
+	ARRAY(
+		SELECT tags.name FROM resource_tags
+		INNER JOIN tags ON tags.id = resource_tags.tag_id
+		WHERE resource_tags.resource_id = resources.id
+		ORDER BY tags.name
+	),
+	EXISTS(SELECT 1 FROM favorites WHERE favorites.resource_id = resources.id AND favorites.user_id = $1),
+	(SELECT COUNT(*) FROM favorites WHERE favorites.resource_id = resources.id),
+	resources.created_by, resources.created_at, resources.updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// rowScannerFunc lets a query scan extra columns after the shared ones.
+type rowScannerFunc func(dest ...any) error
+
+func (f rowScannerFunc) Scan(dest ...any) error {
+	return f(dest...)
+}
+
+func scanResource(row rowScanner) (*Resource, error) {
+	var resource Resource
+	var subjects, tags pgtype.TextArray
+
+	err := row.Scan(
+		&resource.ID,
+		&resource.TypeID,
+		&resource.Title,
+		&resource.Description,
+		&resource.URL,
+		&resource.Author,
+		&resource.Publisher,
+		&resource.Language,
+		&resource.DifficultyLevel,
+		&resource.Rating,
+		&subjects,
+		&tags,
+		&resource.IsFavorited,
+		&resource.FavoriteCount,
+		&resource.CreatedBy,
+		&resource.CreatedAt,
+		&resource.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resource.Subjects = []string{}
+	if err := subjects.AssignTo(&resource.Subjects); err != nil {
+		return nil, err
+	}
+
+	resource.Tags = []string{}
+	if err := tags.AssignTo(&resource.Tags); err != nil {
+		return nil, err
+	}
+
+	return &resource, nil
+}
+
+// SearchResult is a resource matched by a full-text search, with its rank and
+// a highlighted snippet of the text that matched.
+type SearchResult struct {
+	*Resource
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
+}
+
+// ResourceFilters narrows a resource listing. Zero values disable a filter.
+type ResourceFilters struct {
+	TypeID        int
+	Language      string
+	MinDifficulty int
+	MaxDifficulty int
+	MinRating     float64
+	Tag           string
+	Subject       string
+}
+
+// SearchSortColumns only offers relevance; a search is always ranked.
+var SearchSortColumns = map[string]string{
+	"rank": "ts_rank_cd(resources.search_vector, search.query)",
+}
+
+var ResourceSortColumns = map[string]string{
+	"id":               "resources.id",
+	"title":            "resources.title",
+	"created_at":       "resources.created_at",
+	"updated_at":       "resources.updated_at",
+	"difficulty_level": "resources.difficulty_level",
+	"rating":           "resources.rating",
+}
+
+type PostgresResourceStore struct {
+	db *sql.DB
+}
+
+func NewPostgresResourceStore(db *sql.DB) *PostgresResourceStore {
+	return &PostgresResourceStore{db: db}
+}
+
+type ResourceStore interface {
+	CreateResource(*Resource) (*Resource, error)
+	GetResourceByID(id int64, viewerID int) (*Resource, error)
+	UpdateResource(*Resource) (*Resource, error)
+	DeleteResource(id int64) error
+	GetAllResources(viewerID int, resourceFilters ResourceFilters, filters Filters) ([]*Resource, Metadata, error)
+	SearchResources(query string, viewerID int, filters Filters) ([]*SearchResult, Metadata, error)
+}
+
+func lastResourceID(resources []*Resource) int64 {
+	if len(resources) == 0 {
+		return 0
+	}
+	return int64(resources[len(resources)-1].ID)
+}
+
+func (pg *PostgresResourceStore) CreateResource(resource *Resource) (*Resource, error) {
+	query := `
+		INSERT INTO resources (type_id, title, description, url, author, publisher, language, difficulty_level, rating, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, updated_at
+	`
+
+	args := []any{
+		resource.TypeID,
+		resource.Title,
+		resource.Description,
+		resource.URL,
+		resource.Author,
+		resource.Publisher,
+		resource.Language,
+		resource.DifficultyLevel,
+		resource.Rating,
+		resource.CreatedBy,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	resource.Subjects = []string{}
+	resource.Tags = []string{}
+
+	err := pg.db.QueryRowContext(ctx, query, args...).Scan(&resource.ID, &resource.CreatedAt, &resource.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == ForeignKeyViolationErr {
+			return nil, ErrInvalidResourceType
+		}
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (pg *PostgresResourceStore) GetResourceByID(id int64, viewerID int) (*Resource, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + resourceColumns + `
+		FROM resources
+		WHERE resources.id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	resource, err := scanResource(pg.db.QueryRowContext(ctx, query, viewerID, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return resource, nil
+}
+
+func (pg *PostgresResourceStore) UpdateResource(resource *Resource) (*Resource, error) {
+	if resource.ID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE resources
+		SET type_id = $1, title = $2, description = $3, url = $4, author = $5, publisher = $6,
+		    language = $7, difficulty_level = $8, rating = $9, updated_at = NOW()
+		WHERE id = $10
+		RETURNING updated_at
+	`
+
+	args := []any{
+		resource.TypeID,
+		resource.Title,
+		resource.Description,
+		resource.URL,
+		resource.Author,
+		resource.Publisher,
+		resource.Language,
+		resource.DifficultyLevel,
+		resource.Rating,
+		resource.ID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := pg.db.QueryRowContext(ctx, query, args...).Scan(&resource.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		case errors.As(err, &pgErr) && pgErr.Code == ForeignKeyViolationErr:
+			return nil, ErrInvalidResourceType
+		default:
+			return nil, err
+		}
+	}
+
+	return resource, nil
+}
+
+func (pg *PostgresResourceStore) DeleteResource(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM resources
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (pg *PostgresResourceStore) GetAllResources(viewerID int, resourceFilters ResourceFilters, filters Filters) ([]*Resource, Metadata, error) {
+	keyset, keysetArgs := filters.keyset(ResourceSortColumns, "resources.id", 11)
+
+	query := `
+		SELECT ` + resourceColumns + `, count(*) OVER(), ` + filters.cursorColumn(ResourceSortColumns) + `
+		FROM resources
+		WHERE ` + keyset + `
+		AND ($2 = 0 OR resources.type_id = $2)
+		AND ($3 = '' OR resources.language = $3)
+		AND ($4 = 0 OR resources.difficulty_level >= $4)
+		AND ($5 = 0 OR resources.difficulty_level <= $5)
+		AND ($6::numeric = 0 OR resources.rating >= $6::numeric)
+		AND ($7 = '' OR EXISTS (
+			SELECT 1 FROM resource_tags
+			INNER JOIN tags ON tags.id = resource_tags.tag_id
+			WHERE resource_tags.resource_id = resources.id AND LOWER(tags.name) = LOWER($7)
+		))
+		AND ($8 = '' OR EXISTS (
+			SELECT 1 FROM resource_subjects
+			INNER JOIN subjects ON subjects.id = resource_subjects.subject_id
+			WHERE resource_subjects.resource_id = resources.id AND LOWER(subjects.name) = LOWER($8)
+		))
+		ORDER BY ` + filters.orderBy(ResourceSortColumns, "resources.id") + `
+		LIMIT $9 OFFSET $10
+	`
+
+	args := []any{
+		viewerID,
+		resourceFilters.TypeID,
+		resourceFilters.Language,
+		resourceFilters.MinDifficulty,
+		resourceFilters.MaxDifficulty,
+		resourceFilters.MinRating,
+		resourceFilters.Tag,
+		resourceFilters.Subject,
+		filters.limit(),
+		filters.offset(),
+	}
+	args = append(args, keysetArgs...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, filters.cursorError(err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var cursorValue sql.NullString
+	resources := []*Resource{}
+
+	for rows.Next() {
+		resource, err := scanResource(rowScannerFunc(func(dest ...any) error {
+			return rows.Scan(append(dest, &totalRecords, &cursorValue)...)
+		}))
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		resources = append(resources, resource)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return resources, filters.metadata(totalRecords, len(resources), lastResourceID(resources), cursorValue), nil
+}
+
+// SearchResources ranks resources against query. English text is matched with
+// stemming; CJK text is matched as a phrase of single characters, which
+// mirrors how cjk_tokens indexes it.
+func (pg *PostgresResourceStore) SearchResources(query string, viewerID int, filters Filters) ([]*SearchResult, Metadata, error) {
+	keyset, keysetArgs := filters.keyset(SearchSortColumns, "resources.id", 5)
+
+	sqlQuery := `
+		WITH search AS (
+			SELECT websearch_to_tsquery('english', $2) || phraseto_tsquery('simple', cjk_tokens($2)) AS query
+		)
+		SELECT ` + resourceColumns + `, ` + SearchSortColumns["rank"] + `,
+			` + headline("resources.description") + `, ` + headline("resources.title") + `,
+			count(*) OVER(), ` + filters.cursorColumn(SearchSortColumns) + `
+		FROM resources, search
+		WHERE resources.search_vector @@ search.query
+		AND ` + keyset + `
+		ORDER BY ` + filters.orderBy(SearchSortColumns, "resources.id") + `
+		LIMIT $3 OFFSET $4
+	`
+
+	args := append([]any{viewerID, query, filters.limit(), filters.offset()}, keysetArgs...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, Metadata{}, filters.cursorError(err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var cursorValue sql.NullString
+	results := []*SearchResult{}
+	resources := []*Resource{}
+
+	for rows.Next() {
+		var rank float64
+		var descriptionHeadline, titleHeadline string
+		resource, err := scanResource(rowScannerFunc(func(dest ...any) error {
+			return rows.Scan(append(dest, &rank, &descriptionHeadline, &titleHeadline, &totalRecords, &cursorValue)...)
+		}))
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		// ts_headline marks stemmed English matches; a CJK match leaves both
+		// headlines unmarked and falls back to the substring highlighter.
+		highlight := descriptionHeadline
+		if !strings.Contains(highlight, "<b>") {
+			highlight = titleHeadline
+		}
+		if !strings.Contains(highlight, "<b>") {
+			highlight = Highlight(resource.Description, query)
+			if !strings.Contains(highlight, "<b>") {
+				highlight = Highlight(resource.Title, query)
+			}
+		}
+
+		results = append(results, &SearchResult{
+			Resource:  resource,
+			Rank:      rank,
+			Highlight: highlight,
+		})
+		resources = append(resources, resource)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return results, filters.metadata(totalRecords, len(results), lastResourceID(resources), cursorValue), nil
+}
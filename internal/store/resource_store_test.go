@@ -0,0 +1,104 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateResource(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	resourceTypeStore := NewPostgresResourceTypeStore(db)
+	store := NewPostgresResourceStore(db)
+
+	resourceType, err := resourceTypeStore.CreateResourceType(&ResourceType{Name: "book"})
+	require.NoError(t, err)
+
+	rating := 4.5
+
+	tests := []struct {
+		name     string
+		resource Resource
+		wantErr  error
+	}{
+		{
+			name: "valid resource",
+			resource: Resource{
+				TypeID:          resourceType.ID,
+				Title:           "The Go Programming Language",
+				Author:          "Alan Donovan",
+				Language:        "en",
+				DifficultyLevel: 3,
+				Rating:          &rating,
+			},
+		},
+		{
+			name: "resource without rating",
+			resource: Resource{
+				TypeID:          resourceType.ID,
+				Title:           "Go 語言學習筆記",
+				Language:        "zh-Hant",
+				DifficultyLevel: 1,
+			},
+		},
+		{
+			name: "resource with unknown type",
+			resource: Resource{
+				TypeID:          resourceType.ID + 1000,
+				Title:           "orphan",
+				Language:        "en",
+				DifficultyLevel: 1,
+			},
+			wantErr: ErrInvalidResourceType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created, err := store.CreateResource(&tt.resource)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+
+			retrieved, err := store.GetResourceByID(int64(created.ID), 0)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.resource.Title, retrieved.Title)
+			assert.Equal(t, tt.resource.Author, retrieved.Author)
+			assert.Equal(t, tt.resource.Rating, retrieved.Rating)
+		})
+	}
+}
+
+func TestSearchResourcesHighlightsStemmedMatches(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	resourceTypeStore := NewPostgresResourceTypeStore(db)
+	store := NewPostgresResourceStore(db)
+
+	resourceType, err := resourceTypeStore.CreateResourceType(&ResourceType{Name: "article"})
+	require.NoError(t, err)
+
+	_, err = store.CreateResource(&Resource{
+		TypeID:          resourceType.ID,
+		Title:           "Marathon training",
+		Description:     "She runs <every> morning before work.",
+		Language:        "en",
+		DifficultyLevel: 1,
+	})
+	require.NoError(t, err)
+
+	results, _, err := store.SearchResources("running", 0, Filters{Page: 1, PageSize: 10, Sort: []string{"-rank"}})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	assert.Contains(t, results[0].Highlight, "<b>runs</b>")
+	assert.Contains(t, results[0].Highlight, "&lt;every&gt;")
+}
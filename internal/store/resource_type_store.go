@@ -15,6 +15,12 @@ type ResourceType struct {
 	Description string `json:"description"`
 }
 
+var ResourceTypeSortColumns = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"created_at": "created_at",
+}
+
 type PostgresResourceTypeStore struct {
 	db *sql.DB
 }
@@ -28,7 +34,7 @@ type ResourceTypeStore interface {
 	GetResourceTypeByID(id int64) (*ResourceType, error)
 	UpdateResourceType(*ResourceType) (*ResourceType, error)
 	DeleteResourceType(id int64) error
-	GetAllResourceType() ([]*ResourceType, error)
+	GetAllResourceType(filters Filters) ([]*ResourceType, Metadata, error)
 	ResetResourceType() error
 }
 
@@ -148,43 +154,58 @@ func (pg *PostgresResourceTypeStore) DeleteResourceType(id int64) error {
 	return nil
 }
 
-func (pg *PostgresResourceTypeStore) GetAllResourceType() ([]*ResourceType, error) {
+func (pg *PostgresResourceTypeStore) GetAllResourceType(filters Filters) ([]*ResourceType, Metadata, error) {
+	keyset, keysetArgs := filters.keyset(ResourceTypeSortColumns, "id", 3)
+
 	query := `
-		SELECT id, name, description
+		SELECT count(*) OVER(), ` + filters.cursorColumn(ResourceTypeSortColumns) + `, id, name, COALESCE(description, '')
 		FROM resource_types
-		ORDER BY id
+		WHERE ` + keyset + `
+		ORDER BY ` + filters.orderBy(ResourceTypeSortColumns, "id") + `
+		LIMIT $1 OFFSET $2
 	`
 
+	args := append([]any{filters.limit(), filters.offset()}, keysetArgs...)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := pg.db.QueryContext(ctx, query)
+	rows, err := pg.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, filters.cursorError(err)
 	}
 	defer rows.Close()
 
+	totalRecords := 0
+	var cursorValue sql.NullString
 	resourceTypes := []*ResourceType{}
 
 	for rows.Next() {
 		var resourceType ResourceType
 		err := rows.Scan(
+			&totalRecords,
+			&cursorValue,
 			&resourceType.ID,
 			&resourceType.Name,
 			&resourceType.Description,
 		)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 
 		resourceTypes = append(resourceTypes, &resourceType)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
+	}
+
+	var lastID int64
+	if len(resourceTypes) > 0 {
+		lastID = int64(resourceTypes[len(resourceTypes)-1].ID)
 	}
 
-	return resourceTypes, nil
+	return resourceTypes, filters.metadata(totalRecords, len(resourceTypes), lastID, cursorValue), nil
 }
 
 func (pg *PostgresResourceTypeStore) ResetResourceType() error {
@@ -83,3 +83,16 @@ func TestCreateResourceType(t *testing.T) {
 		})
 	}
 }
+
+func TestGetAllResourceTypeRejectsForgedCursor(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresResourceTypeStore(db)
+
+	value := "abc"
+	filters := Filters{PageSize: 20, Sort: []string{"created_at"}, Cursor: &Cursor{Sort: "created_at", Value: &value, ID: 1}}
+
+	_, _, err := store.GetAllResourceType(filters)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
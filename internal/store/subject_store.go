@@ -0,0 +1,44 @@
+package store
+
+import (
+	"database/sql"
+)
+
+type Subject = NamedRecord
+
+type PostgresSubjectStore struct {
+	*nameStore
+}
+
+func NewPostgresSubjectStore(db *sql.DB) *PostgresSubjectStore {
+	return &PostgresSubjectStore{nameStore: &nameStore{
+		db: db,
+		nameTable: nameTable{
+			table:        "subjects",
+			joinTable:    "resource_subjects",
+			joinColumn:   "subject_id",
+			errDuplicate: ErrDuplicateSubject,
+			errInvalid:   ErrInvalidSubject,
+		},
+	}}
+}
+
+type SubjectStore interface {
+	NameStore
+	SetResourceSubjects(resourceID int64, subjectIDs []int64) error
+	AddResourceSubjects(resourceID int64, subjectIDs []int64) error
+	RemoveResourceSubject(resourceID, subjectID int64) error
+}
+
+// SetResourceSubjects makes subjectIDs the resource's only subjects.
+func (pg *PostgresSubjectStore) SetResourceSubjects(resourceID int64, subjectIDs []int64) error {
+	return pg.setForResource(resourceID, subjectIDs)
+}
+
+func (pg *PostgresSubjectStore) AddResourceSubjects(resourceID int64, subjectIDs []int64) error {
+	return pg.addToResource(resourceID, subjectIDs)
+}
+
+func (pg *PostgresSubjectStore) RemoveResourceSubject(resourceID, subjectID int64) error {
+	return pg.removeFromResource(resourceID, subjectID)
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"database/sql"
+)
+
+type Tag = NamedRecord
+
+type PostgresTagStore struct {
+	*nameStore
+}
+
+func NewPostgresTagStore(db *sql.DB) *PostgresTagStore {
+	return &PostgresTagStore{nameStore: &nameStore{
+		db: db,
+		nameTable: nameTable{
+			table:        "tags",
+			joinTable:    "resource_tags",
+			joinColumn:   "tag_id",
+			errDuplicate: ErrDuplicateTag,
+			errInvalid:   ErrInvalidTag,
+		},
+	}}
+}
+
+type TagStore interface {
+	NameStore
+	SetResourceTags(resourceID int64, tagIDs []int64) error
+	AddResourceTags(resourceID int64, tagIDs []int64) error
+	RemoveResourceTag(resourceID, tagID int64) error
+}
+
+// SetResourceTags drops any tag of the resource not in tagIDs.
+func (pg *PostgresTagStore) SetResourceTags(resourceID int64, tagIDs []int64) error {
+	return pg.setForResource(resourceID, tagIDs)
+}
+
+func (pg *PostgresTagStore) AddResourceTags(resourceID int64, tagIDs []int64) error {
+	return pg.addToResource(resourceID, tagIDs)
+}
+
+func (pg *PostgresTagStore) RemoveResourceTag(resourceID, tagID int64) error {
+	return pg.removeFromResource(resourceID, tagID)
+}
@@ -22,20 +22,27 @@ type TokenStore interface {
 	Insert(token *tokens.Token) error
 	CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error)
 	DeleteAllTokensForUser(userID int, scope string) error
+	DeleteOtherTokensForUser(userID int, scope, keepPlaintext string) error
+	DeleteToken(scope, tokenPlaintext string) error
 }
 
 func (t *PostgresTokenStore) Insert(token *tokens.Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertToken(ctx, t.db, token)
+}
+
+// insertToken lets other stores save a token inside their own transaction.
+func insertToken(ctx context.Context, e execer, token *tokens.Token) error {
 	query := `
 		INSERT INTO tokens (hash, user_id, expiry, scope)
 		VALUES($1, $2, $3, $4)
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
 	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
 
-	_, err := t.db.ExecContext(ctx, query, args...)
+	_, err := e.ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -76,3 +83,54 @@ func (t *PostgresTokenStore) DeleteAllTokensForUser(userID int, scope string) er
 
 	return nil
 }
+
+// DeleteOtherTokensForUser revokes every token of the user in scope except
+// keepPlaintext, so the session making the request stays signed in.
+func (t *PostgresTokenStore) DeleteOtherTokensForUser(userID int, scope, keepPlaintext string) error {
+	query := `
+		DELETE FROM tokens
+		WHERE scope = $1 AND user_id = $2 AND hash <> $3
+	`
+
+	args := []any{
+		scope,
+		userID,
+		tokens.HashTokenPlainText(keepPlaintext),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (t *PostgresTokenStore) DeleteToken(scope, tokenPlaintext string) error {
+	query := `
+		DELETE FROM tokens
+		WHERE scope = $1 AND hash = $2
+	`
+
+	args := []any{
+		scope,
+		tokens.HashTokenPlainText(tokenPlaintext),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := t.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -17,11 +17,16 @@ type password struct {
 }
 
 type User struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	Activated bool      `json:"activated"`
+	ID           int      `json:"id"`
+	Name         string   `json:"username"`
+	Email        string   `json:"email"`
+	PendingEmail *string  `json:"pending_email,omitzero"`
+	Password     password `json:"-"`
+	Activated    bool     `json:"activated"`
+	MFAEnabled   bool     `json:"mfa_enabled"`
+	// Locale picks the language of emails sent to the user. Empty means the
+	// mailer's default.
+	Locale    string    `json:"locale,omitzero"`
 	Version   int       `json:"-"`
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -44,9 +49,12 @@ func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
 
 type UserStore interface {
 	CreateUser(*User) error
+	RegisterUser(user *User, activationToken *tokens.Token, welcome *OutboxEmail) error
 	UpdateUser(*User) error
 	GetUserByName(username string) (*User, error)
+	GetUserByEmail(email string) (*User, error)
 	GetForToken(tokenScope, tokenPlaintext string) (*User, error)
+	DeleteUser(id int) error
 }
 
 func (p *password) Set(plaintextPassword string) error {
@@ -74,17 +82,54 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 }
 
 func (s *PostgresUserStore) CreateUser(user *User) error {
-	query := `
-		INSERT INTO users (name, email, password_hash, activated)
-		VALUES($1, $2, $3, $4)
-		RETURNING id, created_at, version
-	`
-	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertUser(ctx, s.db, user)
+}
 
+// RegisterUser creates the user together with their activation token and the
+// welcome email that delivers it. Either all of them are saved or none is, so
+// a new user is never left without a way to activate.
+func (s *PostgresUserStore) RegisterUser(user *User, activationToken *tokens.Token, welcome *OutboxEmail) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertUser(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	activationToken.UserID = user.ID
+	err = insertToken(ctx, tx, activationToken)
+	if err != nil {
+		return err
+	}
+
+	err = enqueueEmail(ctx, tx, welcome)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertUser lets other stores create a user inside their own transaction.
+func insertUser(ctx context.Context, q queryer, user *User) error {
+	query := `
+		INSERT INTO users (name, email, password_hash, activated, locale)
+		VALUES($1, $2, $3, $4, $5)
+		RETURNING id, created_at, version
+	`
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.Locale}
+
+	err := q.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == UniqueViolationErr {
@@ -107,7 +152,7 @@ func (s *PostgresUserStore) GetUserByName(username string) (*User, error) {
 	}
 
 	query := `
-		SELECT id, username, email, password_hash, activated, created_at, version
+		SELECT id, name, email, pending_email, password_hash, activated, totp_enabled, locale, created_at, version
 		FROM users
 		WHERE name = $1;
 	`
@@ -119,8 +164,50 @@ func (s *PostgresUserStore) GetUserByName(username string) (*User, error) {
 		&user.ID,
 		&user.Name,
 		&user.Email,
+		&user.PendingEmail,
 		&user.Password.hash,
 		&user.Activated,
+		&user.MFAEnabled,
+		&user.Locale,
+		&user.CreatedAt,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+
+	}
+
+	return user, nil
+}
+
+func (s *PostgresUserStore) GetUserByEmail(email string) (*User, error) {
+	user := &User{
+		Password: password{},
+	}
+
+	query := `
+		SELECT id, name, email, pending_email, password_hash, activated, totp_enabled, locale, created_at, version
+		FROM users
+		WHERE email = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.PendingEmail,
+		&user.Password.hash,
+		&user.Activated,
+		&user.MFAEnabled,
+		&user.Locale,
 		&user.CreatedAt,
 		&user.Version,
 	)
@@ -141,7 +228,7 @@ func (s *PostgresUserStore) GetForToken(tokenScope, tokenPlaintext string) (*Use
 	hash := tokens.HashTokenPlainText(tokenPlaintext)
 
 	query := `
-		SELECT users.id, users.created_at, users.name, users.email, users.password_hash,users.activated
+		SELECT users.id, users.created_at, users.name, users.email, users.pending_email, users.password_hash, users.activated, users.totp_enabled, users.locale, users.version
 		FROM users
 		INNER JOIN tokens
 		ON users.id = tokens.user_id
@@ -168,8 +255,12 @@ func (s *PostgresUserStore) GetForToken(tokenScope, tokenPlaintext string) (*Use
 		&user.CreatedAt,
 		&user.Name,
 		&user.Email,
+		&user.PendingEmail,
 		&user.Password.hash,
 		&user.Activated,
+		&user.MFAEnabled,
+		&user.Locale,
+		&user.Version,
 	)
 
 	if err != nil {
@@ -187,16 +278,18 @@ func (s *PostgresUserStore) GetForToken(tokenScope, tokenPlaintext string) (*Use
 func (s *PostgresUserStore) UpdateUser(user *User) error {
 	query := `
 		UPDATE users
-		SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $5 AND version = $6
+		SET name = $1, email = $2, pending_email = $3, password_hash = $4, activated = $5, locale = $6, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $7 AND version = $8
 		RETURNING version
 	`
 
 	args := []any{
 		user.Name,
 		user.Email,
+		user.PendingEmail,
 		user.Password.hash,
 		user.Activated,
+		user.Locale,
 		user.ID,
 		user.Version,
 	}
@@ -206,6 +299,10 @@ func (s *PostgresUserStore) UpdateUser(user *User) error {
 
 	err := s.db.QueryRowContext(ctx, query, args...).Scan(&user.Version)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == UniqueViolationErr {
 			if pgErr.ConstraintName == "users_email_key" {
@@ -221,3 +318,58 @@ func (s *PostgresUserStore) UpdateUser(user *User) error {
 
 	return nil
 }
+
+// DeleteUser removes the user. Tokens, permissions and favorites go with it,
+// while comments and resources are kept with their user reference cleared.
+// Failed login counters and queued emails for the account are removed in the
+// same transaction, since both hold its name or addresses.
+func (s *PostgresUserStore) DeleteUser(id int) error {
+	query := `
+		DELETE FROM users
+		WHERE id = $1
+		RETURNING name, email, pending_email
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var name, email string
+	var pendingEmail sql.NullString
+	err = tx.QueryRowContext(ctx, query, id).Scan(&name, &email, &pendingEmail)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	query = `
+		DELETE FROM login_attempts
+		WHERE key IN ('user:' || lower($1), 'user:' || lower($2))
+	`
+
+	_, err = tx.ExecContext(ctx, query, name, email)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		DELETE FROM email_outbox
+		WHERE recipient IN ($1, $2)
+	`
+
+	_, err = tx.ExecContext(ctx, query, email, pendingEmail)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,128 @@
+package throttle
+
+import (
+	"strings"
+	"time"
+
+	"github.com/y3933y3933/knowstro/internal/store"
+)
+
+// Policy describes how quickly failed logins for one key are locked out.
+type Policy struct {
+	// FreeAttempts is how many failures are tolerated before any lockout.
+	FreeAttempts int
+	// BaseDelay is the lockout after the first failure past FreeAttempts. It
+	// doubles with every further failure, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long a failure is remembered.
+	Window time.Duration
+}
+
+var (
+	DefaultUserPolicy = Policy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 15 * time.Minute, Window: time.Hour}
+	DefaultIPPolicy   = Policy{FreeAttempts: 20, BaseDelay: time.Second, MaxDelay: 15 * time.Minute, Window: time.Hour}
+)
+
+// DefaultWarnAfter is the number of failures for a username after which its
+// owner is warned by email.
+const DefaultWarnAfter = 5
+
+// Lockout returns how long to lock a key out after its nth failure.
+func (p Policy) Lockout(failures int) time.Duration {
+	excess := failures - p.FreeAttempts
+	if excess <= 0 {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < excess; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// LoginThrottle tracks failed logins per username and per client IP.
+type LoginThrottle struct {
+	store     store.LoginAttemptStore
+	user      Policy
+	ip        Policy
+	warnAfter int
+}
+
+func NewLoginThrottle(store store.LoginAttemptStore, user, ip Policy, warnAfter int) *LoginThrottle {
+	return &LoginThrottle{
+		store:     store,
+		user:      user,
+		ip:        ip,
+		warnAfter: warnAfter,
+	}
+}
+
+func userKey(name string) string {
+	return "user:" + strings.ToLower(name)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns how long the caller must wait before trying to log in again,
+// or zero if the login may proceed.
+func (t *LoginThrottle) Check(name, ip string, now time.Time) (time.Duration, error) {
+	var retryAfter time.Duration
+
+	for _, key := range []string{userKey(name), ipKey(ip)} {
+		attempt, err := t.store.GetLoginAttempt(key)
+		if err != nil {
+			return 0, err
+		}
+
+		retryAfter = max(retryAfter, attempt.LockedUntil.Sub(now))
+	}
+
+	return retryAfter, nil
+}
+
+// Fail records a failed login and locks out the username and IP as their
+// policies require. It returns the recent failures of the username and
+// whether its owner should now be warned.
+func (t *LoginThrottle) Fail(name, ip string, now time.Time) (int, bool, error) {
+	failures := 0
+
+	for _, k := range []struct {
+		key    string
+		policy Policy
+		isUser bool
+	}{
+		{userKey(name), t.user, true},
+		{ipKey(ip), t.ip, false},
+	} {
+		attempt, err := t.store.RecordFailedLogin(k.key, now, k.policy.Window)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if lockout := k.policy.Lockout(attempt.Failures); lockout > 0 {
+			err = t.store.LockLogin(k.key, now.Add(lockout))
+			if err != nil {
+				return 0, false, err
+			}
+		}
+
+		if k.isUser {
+			failures = attempt.Failures
+		}
+	}
+
+	return failures, failures == t.warnAfter, nil
+}
+
+// Succeed forgets the failures of a username after a successful login. The
+// IP is left alone so one valid account cannot clear an attacker's record.
+func (t *LoginThrottle) Succeed(name string) error {
+	return t.store.ResetLoginAttempts(userKey(name))
+}
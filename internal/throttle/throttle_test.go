@@ -0,0 +1,79 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y3933y3933/knowstro/internal/store"
+)
+
+func TestPolicyLockout(t *testing.T) {
+	policy := Policy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second, Window: time.Hour}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, policy.Lockout(tt.failures), "failures=%d", tt.failures)
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	user := Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	ip := Policy{FreeAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	throttle := NewLoginThrottle(store.NewMemoryLoginAttemptStore(), user, ip, 3)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 2; i++ {
+		failures, warn, err := throttle.Fail("Alice", "10.0.0.1", now)
+		require.NoError(t, err)
+		assert.Equal(t, i, failures)
+		assert.False(t, warn)
+	}
+
+	retryAfter, err := throttle.Check("alice", "10.0.0.2", now)
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter, "free attempts should not lock")
+
+	_, warn, err := throttle.Fail("alice", "10.0.0.1", now)
+	require.NoError(t, err)
+	assert.True(t, warn, "third failure should warn")
+
+	retryAfter, err = throttle.Check("ALICE", "10.0.0.2", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, retryAfter, "username lock applies from any IP")
+
+	retryAfter, err = throttle.Check("alice", "10.0.0.2", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.LessOrEqual(t, retryAfter, time.Duration(0), "lock expires")
+
+	require.NoError(t, throttle.Succeed("alice"))
+
+	retryAfter, err = throttle.Check("alice", "10.0.0.2", now)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, retryAfter, time.Duration(0), "success clears the username")
+
+	later := now.Add(2 * time.Hour)
+	for i := 1; i <= 6; i++ {
+		_, _, err := throttle.Fail("user"+string(rune('a'+i)), "10.0.0.9", later)
+		require.NoError(t, err)
+	}
+
+	retryAfter, err = throttle.Check("someone", "10.0.0.9", later)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, retryAfter, "IP lock applies to every username")
+}
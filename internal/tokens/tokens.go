@@ -8,8 +8,11 @@ import (
 )
 
 const (
-	ScopeActivation = "activation"
-	ScopeAuth       = "authenticate"
+	ScopeActivation    = "activation"
+	ScopeAuth          = "authenticate"
+	ScopePasswordReset = "password-reset"
+	ScopeEmailChange   = "email-change"
+	ScopeMFAPending    = "mfa-pending"
 )
 
 type Token struct {
@@ -43,3 +46,21 @@ func HashTokenPlainText(tokenPlaintext string) []byte {
 	hash := sha256.Sum256([]byte(tokenPlaintext))
 	return hash[:]
 }
+
+// APIKeyPrefix marks personal API keys so they are easy to tell apart from
+// session tokens, for people and for secret scanners.
+const APIKeyPrefix = "ks_"
+
+// GenerateAPIKey returns a new personal API key and its hash. Like tokens,
+// only the hash is ever stored.
+func GenerateAPIKey() (string, []byte, error) {
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	plaintext := APIKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	return plaintext, HashTokenPlainText(plaintext), nil
+}
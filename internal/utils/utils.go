@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/y3933y3933/knowstro/internal/response"
+	"github.com/y3933y3933/knowstro/internal/store"
 )
 
 // TODO: validator field error handling
@@ -56,10 +58,14 @@ func ReadJSON(c *gin.Context, dst any) error {
 }
 
 func ReadIDParam(c *gin.Context) (int64, error) {
-	s := c.Param("id")
+	return ReadNamedIDParam(c, "id")
+}
+
+func ReadNamedIDParam(c *gin.Context, name string) (int64, error) {
+	s := c.Param(name)
 	i, err := strconv.ParseInt(s, 10, 64)
 	if err != nil || i < 1 {
-		return 0, errors.New("Invalid ID parameter")
+		return 0, fmt.Errorf("Invalid %s parameter", name)
 	}
 
 	return i, nil
@@ -83,6 +89,14 @@ func msgForTag(fe validator.FieldError) string {
 		return fmt.Sprintf("%s cannot be longer than %s characters", fe.Field(), fe.Param())
 	case "email":
 		return fmt.Sprintf("%s must be a valid email address", fe.Field())
+	case "url":
+		return fmt.Sprintf("%s must be a valid URL", fe.Field())
+	case "gte":
+		return fmt.Sprintf("%s must be greater than or equal to %s", fe.Field(), fe.Param())
+	case "lte":
+		return fmt.Sprintf("%s must be less than or equal to %s", fe.Field(), fe.Param())
+	case "bcp47_language_tag":
+		return fmt.Sprintf("%s must be a language tag such as en or zh-Hant", fe.Field())
 	default:
 		return fmt.Sprintf("%s is not valid", fe.Field())
 
@@ -103,3 +117,111 @@ func ValidationErrors(err error) (details []response.FieldError, isValid bool) {
 	}
 	return nil, true
 }
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ReadInt returns the query parameter key as an int, or fallback when it is
+// absent. A malformed value is recorded in errs and fallback is returned.
+func ReadInt(c *gin.Context, key string, fallback int, errs *[]response.FieldError) int {
+	s := c.Query(key)
+	if s == "" {
+		return fallback
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		*errs = append(*errs, response.FieldError{Field: key, Message: fmt.Sprintf("%s must be an integer value", key)})
+		return fallback
+	}
+
+	return i
+}
+
+// ReadFloat is the float64 counterpart of ReadInt.
+func ReadFloat(c *gin.Context, key string, fallback float64, errs *[]response.FieldError) float64 {
+	s := c.Query(key)
+	if s == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		*errs = append(*errs, response.FieldError{Field: key, Message: fmt.Sprintf("%s must be a number", key)})
+		return fallback
+	}
+
+	return f
+}
+
+// ReadCSV splits a comma-separated query parameter, dropping empty entries.
+func ReadCSV(c *gin.Context, key string, fallback []string) []string {
+	s := c.Query(key)
+	if s == "" {
+		return fallback
+	}
+
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// ReadFilters reads the page, page_size, sort and cursor query parameters
+// shared by every list endpoint. Sort keys are checked against sortColumns,
+// the column map the store will order by. A cursor carries its own sort key,
+// so it cannot be combined with page or with a different sort.
+func ReadFilters(c *gin.Context, sortColumns map[string]string, defaultSort []string, errs *[]response.FieldError) store.Filters {
+	filters := store.Filters{
+		Page:     ReadInt(c, "page", 1, errs),
+		PageSize: ReadInt(c, "page_size", DefaultPageSize, errs),
+		Sort:     ReadCSV(c, "sort", defaultSort),
+	}
+
+	if s := c.Query("cursor"); s != "" {
+		cursor, err := store.DecodeCursor(s)
+		if err != nil {
+			*errs = append(*errs, response.FieldError{Field: "cursor", Message: err.Error()})
+			return filters
+		}
+
+		if c.Query("page") != "" {
+			*errs = append(*errs, response.FieldError{Field: "page", Message: "page cannot be combined with cursor"})
+		}
+
+		cursorSort := []string{}
+		if cursor.Sort != "" {
+			cursorSort = []string{cursor.Sort}
+		}
+
+		if c.Query("sort") != "" && !slices.Equal(filters.Sort, cursorSort) {
+			*errs = append(*errs, response.FieldError{Field: "sort", Message: "sort does not match the cursor"})
+		}
+
+		filters.Sort = cursorSort
+		filters.Cursor = cursor
+	}
+
+	if filters.Page < 1 || filters.Page > 10_000_000 {
+		*errs = append(*errs, response.FieldError{Field: "page", Message: "page must be between 1 and 10000000"})
+	}
+
+	if filters.PageSize < 1 || filters.PageSize > MaxPageSize {
+		*errs = append(*errs, response.FieldError{Field: "page_size", Message: fmt.Sprintf("page_size must be between 1 and %d", MaxPageSize)})
+	}
+
+	safelist := store.SortKeys(sortColumns)
+	for _, key := range filters.Sort {
+		if !slices.Contains(safelist, strings.TrimPrefix(key, "-")) {
+			*errs = append(*errs, response.FieldError{Field: "sort", Message: fmt.Sprintf("invalid sort value %q", key)})
+		}
+	}
+
+	return filters
+}
@@ -1,10 +1,7 @@
 package main
 
 import (
-	"fmt"
-	"net/http"
 	"os"
-	"time"
 
 	"github.com/gin-gonic/gin/binding"
 	a "github.com/y3933y3933/knowstro/internal/app"
@@ -19,25 +16,20 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	defer app.DB.Close()
 
-	r := routes.SetupRoutes(app)
-
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", app.Config.Port),
-		Handler:      r,
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+	r, err := routes.SetupRoutes(app)
+	if err != nil {
+		panic(err)
 	}
 
-	app.Logger.Info("starting server", "addr", srv.Addr, "env", app.Config.Env)
+	err = app.Serve(r)
 
-	err = srv.ListenAndServe()
+	// Serve only returns once requests and background tasks are done with the
+	// database.
+	app.DB.Close()
 
 	if err != nil {
 		app.Logger.Error(err.Error())
 		os.Exit(1)
 	}
-
 }
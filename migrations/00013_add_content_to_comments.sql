@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE comments
+  ADD COLUMN content TEXT NOT NULL DEFAULT '',
+  ADD COLUMN depth SMALLINT NOT NULL DEFAULT 0;
+
+ALTER TABLE comments
+  ALTER COLUMN content DROP DEFAULT;
+
+CREATE INDEX IF NOT EXISTS comments_resource_id_idx ON comments (resource_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS comments_resource_id_idx;
+
+ALTER TABLE comments
+  DROP COLUMN depth,
+  DROP COLUMN content;
+-- +goose StatementEnd
@@ -0,0 +1,108 @@
+-- +goose Up
+-- +goose StatementBegin
+-- cjk_tokens pads every CJK character with spaces so the 'simple' parser emits
+-- one token per character. Built-in parsers otherwise treat a run of CJK text
+-- as a single word, which makes substring searches impossible.
+CREATE OR REPLACE FUNCTION cjk_tokens(input TEXT) RETURNS TEXT
+LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$
+  SELECT regexp_replace(
+    COALESCE(input, ''),
+    '([\u3040-\u30ff\u3400-\u4dbf\u4e00-\u9fff\uf900-\ufaff\uac00-\ud7af])',
+    ' \1 ',
+    'g'
+  )
+$$;
+
+-- search_terms holds the names of attached tags and subjects. Generated columns
+-- cannot read other tables, so it is kept in sync by the triggers below.
+ALTER TABLE resources
+  ADD COLUMN search_terms TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE resources
+  ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(author, '') || ' ' || search_terms), 'B') ||
+    setweight(to_tsvector('english', COALESCE(description, '')), 'C') ||
+    setweight(to_tsvector('simple', cjk_tokens(title)), 'A') ||
+    setweight(to_tsvector('simple', cjk_tokens(COALESCE(author, '') || ' ' || search_terms)), 'B') ||
+    setweight(to_tsvector('simple', cjk_tokens(description)), 'C')
+  ) STORED;
+
+CREATE INDEX IF NOT EXISTS resources_search_vector_idx ON resources USING GIN (search_vector);
+
+CREATE OR REPLACE FUNCTION refresh_resource_search_terms(target_id BIGINT) RETURNS VOID
+LANGUAGE sql AS $$
+  UPDATE resources
+  SET search_terms = concat_ws(' ',
+    (SELECT string_agg(tags.name, ' ') FROM resource_tags
+     INNER JOIN tags ON tags.id = resource_tags.tag_id
+     WHERE resource_tags.resource_id = target_id),
+    (SELECT string_agg(subjects.name, ' ') FROM resource_subjects
+     INNER JOIN subjects ON subjects.id = resource_subjects.subject_id
+     WHERE resource_subjects.resource_id = target_id)
+  )
+  WHERE id = target_id
+$$;
+
+CREATE OR REPLACE FUNCTION resource_links_search_terms_trigger() RETURNS TRIGGER
+LANGUAGE plpgsql AS $$
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    PERFORM refresh_resource_search_terms(OLD.resource_id);
+    RETURN OLD;
+  END IF;
+  PERFORM refresh_resource_search_terms(NEW.resource_id);
+  RETURN NEW;
+END
+$$;
+
+CREATE TRIGGER resource_tags_search_terms
+AFTER INSERT OR DELETE ON resource_tags
+FOR EACH ROW EXECUTE FUNCTION resource_links_search_terms_trigger();
+
+CREATE TRIGGER resource_subjects_search_terms
+AFTER INSERT OR DELETE ON resource_subjects
+FOR EACH ROW EXECUTE FUNCTION resource_links_search_terms_trigger();
+
+CREATE OR REPLACE FUNCTION tag_rename_search_terms_trigger() RETURNS TRIGGER
+LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM refresh_resource_search_terms(resource_tags.resource_id)
+  FROM resource_tags WHERE resource_tags.tag_id = NEW.id;
+  RETURN NEW;
+END
+$$;
+
+CREATE TRIGGER tags_search_terms
+AFTER UPDATE OF name ON tags
+FOR EACH ROW EXECUTE FUNCTION tag_rename_search_terms_trigger();
+
+CREATE OR REPLACE FUNCTION subject_rename_search_terms_trigger() RETURNS TRIGGER
+LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM refresh_resource_search_terms(resource_subjects.resource_id)
+  FROM resource_subjects WHERE resource_subjects.subject_id = NEW.id;
+  RETURN NEW;
+END
+$$;
+
+CREATE TRIGGER subjects_search_terms
+AFTER UPDATE OF name ON subjects
+FOR EACH ROW EXECUTE FUNCTION subject_rename_search_terms_trigger();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS subjects_search_terms ON subjects;
+DROP TRIGGER IF EXISTS tags_search_terms ON tags;
+DROP TRIGGER IF EXISTS resource_subjects_search_terms ON resource_subjects;
+DROP TRIGGER IF EXISTS resource_tags_search_terms ON resource_tags;
+DROP FUNCTION IF EXISTS subject_rename_search_terms_trigger();
+DROP FUNCTION IF EXISTS tag_rename_search_terms_trigger();
+DROP FUNCTION IF EXISTS resource_links_search_terms_trigger();
+DROP FUNCTION IF EXISTS refresh_resource_search_terms(BIGINT);
+DROP INDEX IF EXISTS resources_search_vector_idx;
+ALTER TABLE resources DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE resources DROP COLUMN IF EXISTS search_terms;
+DROP FUNCTION IF EXISTS cjk_tokens(TEXT);
+-- +goose StatementEnd
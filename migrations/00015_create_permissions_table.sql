@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS permissions (
+    id BIGSERIAL PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+-- Curators hold the *:write codes; admins additionally hold types:reset and
+-- permissions:write. The first admin has to be granted directly in the
+-- database.
+INSERT INTO permissions (code)
+VALUES
+    ('types:write'),
+    ('subjects:write'),
+    ('tags:write'),
+    ('types:reset'),
+    ('permissions:write')
+ON CONFLICT (code) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS users_permissions;
+DROP TABLE IF EXISTS permissions;
+-- +goose StatementEnd
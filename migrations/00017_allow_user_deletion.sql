@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Comments outlive their author so reply threads stay intact; deleting a user
+-- anonymizes them instead of failing on the NOT NULL constraint.
+ALTER TABLE comments
+  ALTER COLUMN user_id DROP NOT NULL;
+
+ALTER TABLE resources
+  ADD COLUMN created_by BIGINT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments (user_id);
+CREATE INDEX IF NOT EXISTS idx_resources_created_by ON resources (created_by);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_resources_created_by;
+DROP INDEX IF EXISTS idx_comments_user_id;
+
+ALTER TABLE resources
+  DROP COLUMN IF EXISTS created_by;
+
+DELETE FROM comments WHERE user_id IS NULL;
+
+ALTER TABLE comments
+  ALTER COLUMN user_id SET NOT NULL;
+-- +goose StatementEnd
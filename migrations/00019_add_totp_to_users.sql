@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+  ADD COLUMN totp_secret BYTEA,
+  ADD COLUMN totp_enabled BOOL NOT NULL DEFAULT FALSE,
+  ADD COLUMN totp_last_step BIGINT;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    hash BYTEA PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS recovery_codes;
+
+ALTER TABLE users
+  DROP COLUMN IF EXISTS totp_last_step,
+  DROP COLUMN IF EXISTS totp_enabled,
+  DROP COLUMN IF EXISTS totp_secret;
+-- +goose StatementEnd
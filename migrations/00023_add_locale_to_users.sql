@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+  ADD COLUMN locale TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE email_outbox
+  ADD COLUMN locale TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE email_outbox
+  DROP COLUMN IF EXISTS locale;
+
+ALTER TABLE users
+  DROP COLUMN IF EXISTS locale;
+-- +goose StatementEnd
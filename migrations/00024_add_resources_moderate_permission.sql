@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Only a resource's creator may change it unless they hold resources:moderate.
+-- Resources from before 00017 have no recorded creator and cannot be
+-- backfilled, so like those of deleted users they are left to moderators.
+INSERT INTO permissions (code)
+VALUES ('resources:moderate')
+ON CONFLICT (code) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE code = 'resources:moderate';
+-- +goose StatementEnd